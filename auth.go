@@ -0,0 +1,225 @@
+package hiccup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is returned by an [Authenticator] for invalid
+	// credentials, and is sent as a 401 status code.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned by an [Authenticator] for valid credentials
+	// which are not allowed to make the request, and is sent as a 403
+	// status code.
+	ErrForbidden = errors.New("forbidden")
+)
+
+/*
+Authenticator resolves the principal of the credentials sent with a request.
+
+See [BearerAuth], [BasicAuth] and [APIKeyAuth].
+*/
+type Authenticator interface {
+	// Authenticate returns the principal of the request credentials, or nil
+	// if the request has no credentials of the kind. Invalid credentials
+	// return an error wrapping ErrUnauthorized or ErrForbidden.
+	Authenticate(r *http.Request) (any, error)
+	// Challenge returns the "WWW-Authenticate" challenge sent with 401
+	// responses, or an empty string if there is none.
+	Challenge() string
+}
+
+/*
+Auth authenticates requests before the [HandlerFunc] runs.
+
+See [ResponseHandler.SetAuth].
+*/
+type Auth struct {
+	// Authenticators tried in order, until one resolves a principal.
+	Authenticators []Authenticator
+	// Authorize reports whether a principal is allowed to make a request.
+	// Every principal is allowed if nil.
+	Authorize func(r *http.Request, principal any) bool
+	// Requests without credentials run the HandlerFunc without a principal.
+	Optional bool
+}
+
+/*
+SetAuth sets the [Auth] settings of the handler. Passing nil disables
+authentication.
+
+Authentication runs once the response is negotiated, before any
+[Middleware], and before cached or idempotent responses are replayed, so
+replays are never sent to requests which fail it. The resolved principal is
+available to middleware and the [HandlerFunc] with [Principal]. Requests
+without credentials, or with invalid credentials, are sent a 401 status code
+with a "WWW-Authenticate" header for the challenge of every [Authenticator].
+Requests which are not authorized are sent a 403 status code. Both are
+encoded with the negotiated encoder like any other response, without
+running the middleware. Preflight and automatic OPTIONS requests are not
+authenticated.
+*/
+func (h *ResponseHandler) SetAuth(a *Auth) *ResponseHandler {
+	h.auth = a
+	return h
+}
+
+/*
+authenticate resolves the principal of a request, and returns the request
+with the principal set. It returns a [Response] instead if the request
+fails authentication or is not authorized.
+*/
+func (a *Auth) authenticate(r *http.Request) (*http.Request, *Response) {
+	ctx := r.Context()
+	var principal any
+	for _, auth := range a.Authenticators {
+		p, err := auth.Authenticate(r)
+		switch {
+		case errors.Is(err, ErrForbidden):
+			return r, Respond(http.StatusForbidden).SetBody(http.StatusText(http.StatusForbidden))
+		case errors.Is(err, ErrUnauthorized):
+			return r, a.unauthorized()
+		case err != nil:
+			logError(ctx, fmt.Errorf("authenticating request: %w", err))
+			return r, Respond(http.StatusInternalServerError).SetBody(http.StatusText(http.StatusInternalServerError))
+		}
+		if p != nil {
+			principal = p
+			break
+		}
+	}
+
+	if principal == nil {
+		if !a.Optional {
+			return r, a.unauthorized()
+		}
+		return r, nil
+	}
+	if a.Authorize != nil && !a.Authorize(r, principal) {
+		return r, Respond(http.StatusForbidden).SetBody(http.StatusText(http.StatusForbidden))
+	}
+	ctx, slot := principalSlotOf(ctx)
+	slot.principal = principal
+	return r.WithContext(ctx), nil
+}
+
+func (a *Auth) unauthorized() *Response {
+	res := Respond(http.StatusUnauthorized).SetBody(http.StatusText(http.StatusUnauthorized))
+	for _, auth := range a.Authenticators {
+		if c := auth.Challenge(); c != "" {
+			res.AddHeader("WWW-Authenticate", c)
+		}
+	}
+	return res
+}
+
+type principalKey struct{}
+
+/*
+principalSlot holds the principal of a request, so it is available outside
+the [HandlerFunc] once resolved, like to middleware and response redaction.
+*/
+type principalSlot struct {
+	principal any
+}
+
+/*
+withPrincipalSlot returns a context with a new empty principal slot.
+*/
+func withPrincipalSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, principalKey{}, new(principalSlot))
+}
+
+/*
+principalSlotOf returns the principal slot of a context, adding one if
+there is none.
+*/
+func principalSlotOf(ctx context.Context) (context.Context, *principalSlot) {
+	if s, ok := ctx.Value(principalKey{}).(*principalSlot); ok {
+		return ctx, s
+	}
+	s := new(principalSlot)
+	return context.WithValue(ctx, principalKey{}, s), s
+}
+
+/*
+Principal returns the principal resolved by the [Authenticator] of the
+request, or nil if the request is not authenticated.
+*/
+func Principal(r *http.Request) any {
+	if s, ok := r.Context().Value(principalKey{}).(*principalSlot); ok {
+		return s.principal
+	}
+	return nil
+}
+
+type authenticator struct {
+	challenge    string
+	authenticate func(r *http.Request) (any, error)
+}
+
+func (a *authenticator) Authenticate(r *http.Request) (any, error) {
+	return a.authenticate(r)
+}
+
+func (a *authenticator) Challenge() string {
+	return a.challenge
+}
+
+/*
+BearerAuth returns an [Authenticator] for bearer tokens sent in the
+"Authorization" header. The verify function returns the principal of a
+token, or an error wrapping [ErrUnauthorized] if the token is invalid.
+*/
+func BearerAuth(realm string, verify func(ctx context.Context, token string) (any, error)) Authenticator {
+	return &authenticator{
+		challenge: fmt.Sprintf("Bearer realm=%q", realm),
+		authenticate: func(r *http.Request) (any, error) {
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				return nil, nil
+			}
+			return verify(r.Context(), strings.TrimSpace(token))
+		},
+	}
+}
+
+/*
+BasicAuth returns an [Authenticator] for basic authentication credentials.
+The verify function returns the principal of a user, or an error wrapping
+[ErrUnauthorized] if the password is invalid.
+*/
+func BasicAuth(realm string, verify func(ctx context.Context, user string, password string) (any, error)) Authenticator {
+	return &authenticator{
+		challenge: fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm),
+		authenticate: func(r *http.Request) (any, error) {
+			user, password, ok := r.BasicAuth()
+			if !ok {
+				return nil, nil
+			}
+			return verify(r.Context(), user, password)
+		},
+	}
+}
+
+/*
+APIKeyAuth returns an [Authenticator] for API keys sent in a request
+header. The verify function returns the principal of a key, or an error
+wrapping [ErrUnauthorized] if the key is invalid. API keys have no
+challenge.
+*/
+func APIKeyAuth(header string, verify func(ctx context.Context, key string) (any, error)) Authenticator {
+	return &authenticator{
+		authenticate: func(r *http.Request) (any, error) {
+			key := r.Header.Get(header)
+			if key == "" {
+				return nil, nil
+			}
+			return verify(r.Context(), key)
+		},
+	}
+}
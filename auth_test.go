@@ -0,0 +1,156 @@
+package hiccup_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+type user struct {
+	Name  string
+	Admin bool
+}
+
+func verifyToken(ctx context.Context, token string) (any, error) {
+	switch token {
+	case "admin":
+		return user{Name: "admin", Admin: true}, nil
+	case "guest":
+		return user{Name: "guest"}, nil
+	case "revoked":
+		return nil, fmt.Errorf("token revoked: %w", hiccup.ErrForbidden)
+	case "broken":
+		return nil, errors.New("token store unavailable")
+	}
+	return nil, hiccup.ErrUnauthorized
+}
+
+func ExampleResponseHandler_SetAuth() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		u := hiccup.Principal(r).(user)
+		return hiccup.Respond(http.StatusOK).SetBody("Hello " + u.Name)
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetAuth(&hiccup.Auth{
+			Authenticators: []hiccup.Authenticator{hiccup.BearerAuth("api", verifyToken)},
+		})
+
+	for _, token := range []string{"admin", ""} {
+		w, req := testRequest("GET", "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(w, req)
+		fmt.Println(w.Code, w.Header().Get("WWW-Authenticate"), w.Body.String())
+	}
+	// Output:
+	// 200  "Hello admin"
+	// 401 Bearer realm="api" "Unauthorized"
+}
+
+func TestResponseHandler_SetAuth(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if u, ok := hiccup.Principal(r).(user); ok {
+			return hiccup.Respond(http.StatusOK).SetBody(u.Name)
+		}
+		return hiccup.Respond(http.StatusOK).SetBody("anonymous")
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetAuth(&hiccup.Auth{
+			Authenticators: []hiccup.Authenticator{
+				hiccup.BearerAuth("api", verifyToken),
+				hiccup.BasicAuth("api", func(ctx context.Context, name, password string) (any, error) {
+					if password != "secret" {
+						return nil, hiccup.ErrUnauthorized
+					}
+					return user{Name: name}, nil
+				}),
+				hiccup.APIKeyAuth("X-Api-Key", func(ctx context.Context, key string) (any, error) {
+					return verifyToken(ctx, key)
+				}),
+			},
+			Authorize: func(r *http.Request, principal any) bool {
+				return r.Method == http.MethodGet || principal.(user).Admin
+			},
+		})
+	bearer := func(method, token string) *hiccuptest.Request {
+		return hiccuptest.NewRequest(method, "/").Header("Authorization", "Bearer "+token)
+	}
+
+	res := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Status(http.StatusUnauthorized).
+		Header("Content-Type", "application/json").
+		Text(`"Unauthorized"`)
+	want := `[Bearer realm="api" Basic realm="api", charset="UTF-8"]`
+	if got := fmt.Sprint(res.Response.Header.Values("WWW-Authenticate")); got != want {
+		t.Error("challenges are", got, "want", want)
+		t.FailNow()
+	}
+
+	hiccuptest.Do(t, handler, bearer("GET", "guest")).Status(http.StatusOK).Text(`"guest"`)
+	hiccuptest.Do(t, handler, bearer("GET", "invalid")).Status(http.StatusUnauthorized)
+	hiccuptest.Do(t, handler, bearer("GET", "revoked")).Status(http.StatusForbidden).Text(`"Forbidden"`)
+	hiccuptest.Do(t, handler, bearer("GET", "broken")).Status(http.StatusInternalServerError)
+	hiccuptest.Do(t, handler, bearer("POST", "guest")).Status(http.StatusForbidden).Header("WWW-Authenticate", "")
+	hiccuptest.Do(t, handler, bearer("POST", "admin")).Status(http.StatusOK)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Authorization", "Basic dXNlcjpzZWNyZXQ=")).
+		Status(http.StatusOK).
+		Text(`"user"`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("X-Api-Key", "guest")).
+		Status(http.StatusOK).
+		Text(`"guest"`)
+
+	// automatic OPTIONS responses are not authenticated.
+	hiccuptest.Do(t, handler.Describe(hiccup.Operation{Method: "GET", Path: "/"}), hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusNoContent)
+}
+
+func TestAuth_Optional(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(fmt.Sprint(hiccup.Principal(r)))
+	}).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{hiccup.BearerAuth("api", verifyToken)},
+		Optional:       true,
+	})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Status(http.StatusOK).Text("<nil>")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Authorization", "Bearer invalid")).
+		Status(http.StatusUnauthorized)
+}
+
+func TestAuth_Replays(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		return hiccup.Respond(http.StatusOK).
+			SetBody(fmt.Sprint(calls)).
+			SetHeader("Cache-Control", "public, max-age=60")
+	}).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{hiccup.APIKeyAuth("X-Api-Key", verifyToken)},
+	}).SetCache(&hiccup.Cache{Store: hiccup.NewLRUCacheStore(10)}).
+		SetIdempotency(hiccup.NewMemoryIdempotencyStore(time.Minute))
+
+	key := func(req *hiccuptest.Request, key string) *hiccuptest.Request {
+		return req.Header("X-Api-Key", key)
+	}
+
+	// cached responses are only sent to authenticated requests.
+	hiccuptest.Do(t, handler, key(hiccuptest.NewRequest("GET", "/"), "guest")).Status(http.StatusOK).Text("1")
+	hiccuptest.Do(t, handler, key(hiccuptest.NewRequest("GET", "/"), "guest")).Status(http.StatusOK).Text("1")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Status(http.StatusUnauthorized)
+	hiccuptest.Do(t, handler, key(hiccuptest.NewRequest("GET", "/"), "revoked")).Status(http.StatusForbidden)
+
+	// and so are idempotent replays.
+	post := func() *hiccuptest.Request {
+		return hiccuptest.NewRequest("POST", "/").Header("Idempotency-Key", "a")
+	}
+	hiccuptest.Do(t, handler, key(post(), "guest")).Status(http.StatusOK).Text("2")
+	hiccuptest.Do(t, handler, key(post(), "guest")).Status(http.StatusOK).Text("2").Header("Idempotent-Replayed", "true")
+	hiccuptest.Do(t, handler, post()).Status(http.StatusUnauthorized).Header("Idempotent-Replayed", "")
+}
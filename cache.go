@@ -0,0 +1,337 @@
+package hiccup
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Cache stores the encoded responses of GET requests, so they are served
+without running the [HandlerFunc] while fresh.
+
+Responses are stored per method, URL, negotiated content type, and the
+values of the Vary request headers, along with the field mask header of a
+[FieldMask] and the roles of a [Redaction]. Requests with credentials, sent
+in "Authorization" or "Cookie" headers or resolved to a [Principal] by
+[Auth], are sent the responses stored for the same credentials and
+principal only. Add the headers of credentials checked by [Middleware]
+instead to Vary. Only 200 responses without cookies are stored, and the
+"Cache-Control" header of the [Response] is honored: "no-store", "no-cache"
+and "private" responses are not stored, and the "s-maxage" or "max-age"
+directive sets how long a response is fresh. Responses to requests with
+credentials are only stored if "public" or "s-maxage" is set, as shared
+caches do. A "stale-while-revalidate" directive sets how long a stale
+response is still served, while it is refreshed in the background.
+
+Stored responses are looked up within the middleware chain, so they pass
+through any [Middleware] like responses of the HandlerFunc.
+
+See [ResponseHandler.SetCache].
+*/
+type Cache struct {
+	// Backend the responses are stored in.
+	Store CacheStore
+	// How long responses without a max age are fresh. Responses without a max
+	// age are not stored if zero.
+	TTL time.Duration
+	// How long stale responses without a "stale-while-revalidate" directive
+	// are served while they are refreshed.
+	StaleWhileRevalidate time.Duration
+	// Request headers which select different responses, like
+	// "Accept-Language".
+	Vary []string
+
+	revalidating sync.Map
+}
+
+/*
+CacheEntry is a stored response.
+*/
+type CacheEntry struct {
+	// Status code of the response.
+	StatusCode int
+	// Response headers.
+	Header http.Header
+	// Encoded response body.
+	Body []byte
+	// When the response was stored.
+	Stored time.Time
+	// When the response becomes stale.
+	Expires time.Time
+	// When the response can no longer be served while it is refreshed.
+	StaleUntil time.Time
+}
+
+/*
+CacheStore is a [Cache] backend. Implementations must be safe for concurrent
+use, and can drop entries after their StaleUntil time.
+
+See [NewLRUCacheStore].
+*/
+type CacheStore interface {
+	// Get returns the entry of a key, or nil if there is none.
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	// Set stores the entry of a key.
+	Set(ctx context.Context, key string, e *CacheEntry) error
+	// Delete removes the entry of a key.
+	Delete(ctx context.Context, key string) error
+}
+
+/*
+SetCache enables the response [Cache] of the handler. Passing nil disables
+it.
+*/
+func (h *ResponseHandler) SetCache(c *Cache) *ResponseHandler {
+	h.cache = c
+	return h
+}
+
+/*
+cacheKey returns the cache key of a request for the negotiated content type.
+HEAD requests share the responses of GET requests.
+*/
+func (h *ResponseHandler) cacheKey(r *http.Request, n negotiation) string {
+	var b strings.Builder
+	b.WriteString("GET " + r.URL.RequestURI() + "\n" + n.contentType)
+	for _, v := range h.cache.Vary {
+		b.WriteString("\n" + http.CanonicalHeaderKey(v) + ": " + strings.Join(r.Header.Values(v), ", "))
+	}
+	if h.fieldMask != nil && h.fieldMask.Header != "" {
+		b.WriteString("\nmask: " + r.Header.Get(h.fieldMask.Header))
+	}
+	if h.redaction != nil && h.redaction.Roles != nil {
+		if p := Principal(r); p != nil {
+			fmt.Fprintf(&b, "\nroles: %q", h.redaction.Roles(p))
+		}
+	}
+	if scope := clientScope(r); scope != "" {
+		b.WriteString("\nclient: " + scope)
+	}
+	return b.String()
+}
+
+func (h *ResponseHandler) serveCached(w http.ResponseWriter, r *http.Request, n negotiation) {
+	c, ctx := h.cache, r.Context()
+	key := h.cacheKey(r, n)
+
+	// stored responses are looked up within the middleware chain, so they
+	// pass through middleware like responses of the HandlerFunc.
+	missed := false
+	res := h.invokeWith(r, func(r *http.Request) *Response {
+		e, err := c.Store.Get(ctx, key)
+		if err != nil {
+			logError(ctx, err)
+		}
+		now := time.Now()
+		if e == nil || !now.Before(e.StaleUntil) {
+			missed = true
+			return h.handler(r)
+		}
+		if !now.Before(e.Expires) {
+			h.revalidate(r, n, key)
+		}
+		res := &Response{StatusCode: e.StatusCode, HeaderValues: e.Header.Clone(), Body: storedBody(e.Body)}
+		return res.SetHeader("Age", strconv.Itoa(int(now.Sub(e.Stored).Seconds())))
+	})
+	if h.observer != nil {
+		h.observer.HandlerEnd(ctx, res)
+	}
+	if !missed || r.Method != http.MethodGet {
+		h.write(w, r, res, n)
+		return
+	}
+
+	rw := &recordWriter{ResponseWriter: w, status: http.StatusOK}
+	h.write(rw, r, res, n)
+	h.storeCached(ctx, key, rw, clientScope(r) != "")
+}
+
+/*
+revalidate refreshes a stale response in the background, unless it is being
+refreshed already.
+*/
+func (h *ResponseHandler) revalidate(r *http.Request, n negotiation, key string) {
+	c := h.cache
+	if _, busy := c.revalidating.LoadOrStore(key, true); busy {
+		return
+	}
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Method = http.MethodGet
+	go func() {
+		defer c.revalidating.Delete(key)
+		ctx := req.Context()
+		if h.observer != nil {
+			ctx = h.observer.HandlerStart(ctx, req)
+		}
+		req := req.WithContext(ctx)
+		res := h.invoke(req)
+		if h.observer != nil {
+			h.observer.HandlerEnd(ctx, res)
+		}
+		rw := &recordWriter{ResponseWriter: &discardWriter{header: make(http.Header)}, status: http.StatusOK}
+		h.write(rw, req, res, n)
+		h.storeCached(ctx, key, rw, clientScope(req) != "")
+	}()
+}
+
+/*
+storeCached saves a recorded response if it can be cached. Responses to
+requests with credentials must be explicitly shareable.
+*/
+func (h *ResponseHandler) storeCached(ctx context.Context, key string, rw *recordWriter, credentials bool) {
+	c := h.cache
+	header := rw.Header()
+	if rw.status != http.StatusOK || header.Get("Set-Cookie") != "" {
+		return
+	}
+
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return
+	}
+	if _, ok := cc["no-cache"]; ok {
+		return
+	}
+	if _, ok := cc["private"]; ok {
+		return
+	}
+	if _, ok := cc["public"]; credentials && !ok {
+		if _, ok := cc["s-maxage"]; !ok {
+			return
+		}
+	}
+
+	ttl := c.TTL
+	if v, ok := seconds(cc, "s-maxage"); ok {
+		ttl = v
+	} else if v, ok := seconds(cc, "max-age"); ok {
+		ttl = v
+	}
+	if ttl <= 0 {
+		return
+	}
+	swr := c.StaleWhileRevalidate
+	if v, ok := seconds(cc, "stale-while-revalidate"); ok {
+		swr = v
+	}
+
+	now := time.Now()
+	err := c.Store.Set(ctx, key, &CacheEntry{
+		StatusCode: rw.status,
+		Header:     h.storedHeader(header),
+		Body:       append([]byte{}, rw.body.Bytes()...),
+		Stored:     now,
+		Expires:    now.Add(ttl),
+		StaleUntil: now.Add(ttl + swr),
+	})
+	if err != nil {
+		logError(ctx, err)
+	}
+}
+
+/*
+discardWriter is a [http.ResponseWriter] which drops the response.
+*/
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(statusCode int) {}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+/*
+LRUCacheStore is an in-memory [CacheStore] which evicts the least recently
+used entries beyond its size.
+*/
+type LRUCacheStore struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+/*
+NewLRUCacheStore returns a [LRUCacheStore] holding up to size entries.
+*/
+func NewLRUCacheStore(size int) *LRUCacheStore {
+	return &LRUCacheStore{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*lruItem)
+	if time.Now().After(item.entry.StaleUntil) {
+		s.ll.Remove(el)
+		delete(s.items, key)
+		return nil, nil
+	}
+	s.ll.MoveToFront(el)
+	return item.entry, nil
+}
+
+func (s *LRUCacheStore) Set(ctx context.Context, key string, e *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		el.Value.(*lruItem).entry = e
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&lruItem{key: key, entry: e})
+	for s.ll.Len() > s.size {
+		el := s.ll.Back()
+		s.ll.Remove(el)
+		delete(s.items, el.Value.(*lruItem).key)
+	}
+	return nil
+}
+
+func (s *LRUCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.ll.Remove(el)
+		delete(s.items, key)
+	}
+	return nil
+}
+
+/*
+Len returns the number of stored entries.
+*/
+func (s *LRUCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
@@ -0,0 +1,293 @@
+package hiccup_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleResponseHandler_SetCache() {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		return hiccup.Respond(http.StatusOK).
+			SetBody(map[string]int{"calls": calls}).
+			SetHeader("Cache-Control", "public, max-age=60")
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetCache(&hiccup.Cache{Store: hiccup.NewLRUCacheStore(100)})
+
+	for i := 0; i < 2; i++ {
+		w, req := testRequest("GET", "/report", nil)
+		handler.ServeHTTP(w, req)
+		fmt.Printf("%s age=%q\n", w.Body.String(), w.Header().Get("Age"))
+	}
+	// Output:
+	// {"calls":1} age=""
+	// {"calls":1} age="0"
+}
+
+func TestResponseHandler_SetCache(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		res := hiccup.Respond(http.StatusOK).SetBody(map[string]int{"calls": calls})
+		switch r.URL.Path {
+		case "/private":
+			res.SetHeader("Cache-Control", "private, max-age=60")
+		case "/cookie":
+			res.SetCookies([]http.Cookie{{Name: "a", Value: "b"}})
+		case "/missing":
+			res.StatusCode = http.StatusNotFound
+		case "/default":
+		default:
+			res.SetHeader("Cache-Control", "max-age=60")
+		}
+		return res
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetCache(&hiccup.Cache{
+		Store: hiccup.NewLRUCacheStore(10),
+		Vary:  []string{"Accept-Language"},
+	})
+
+	get := func(path string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path)
+	}
+
+	hiccuptest.Do(t, handler, get("/a")).Text(`{"calls":1}`)
+	hiccuptest.Do(t, handler, get("/a")).Text(`{"calls":1}`).Header("Age", "0")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("HEAD", "/a")).Text("").Header("Age", "0")
+
+	// representations are keyed by the negotiated content type and vary headers.
+	hiccuptest.Do(t, handler, get("/a").Accept("application/yaml")).Text("calls: 2\n")
+	hiccuptest.Do(t, handler, get("/a").Accept("application/yaml")).Text("calls: 2\n")
+	hiccuptest.Do(t, handler, get("/a").Header("Accept-Language", "de")).Text(`{"calls":3}`)
+	hiccuptest.Do(t, handler, get("/a?page=2")).Text(`{"calls":4}`)
+
+	// uncacheable responses always run the handler.
+	for _, path := range []string{"/private", "/cookie", "/missing", "/default"} {
+		first := hiccuptest.Do(t, handler, get(path))
+		hiccuptest.Do(t, handler, get(path)).Header("Age", "")
+		if string(first.Body) == fmt.Sprintf(`{"calls":%d}`, calls) {
+			t.Error("response of", path, "served from cache")
+			t.FailNow()
+		}
+	}
+
+	// other methods are not cached.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/a")).Header("Age", "")
+}
+
+func TestCache_Credentials(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		res := hiccup.Respond(http.StatusOK).
+			SetBody(map[string]any{"calls": calls, "name": "a"}).
+			SetHeader("Cache-Control", "max-age=60")
+		if r.URL.Path == "/public" {
+			res.SetHeader("Cache-Control", "public, max-age=60")
+		}
+		return res
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetFieldMask(&hiccup.FieldMask{Header: "X-Fields"}).
+		SetCache(&hiccup.Cache{Store: hiccup.NewLRUCacheStore(10)})
+
+	get := func(path string, auth string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path).Header("Authorization", auth)
+	}
+
+	// responses to requests with credentials must be public to be stored.
+	hiccuptest.Do(t, handler, get("/", "Bearer a")).Text(`{"calls":1,"name":"a"}`)
+	hiccuptest.Do(t, handler, get("/", "Bearer a")).Text(`{"calls":2,"name":"a"}`).Header("Age", "")
+
+	// and are only sent to requests with the same credentials.
+	hiccuptest.Do(t, handler, get("/public", "Bearer a")).Text(`{"calls":3,"name":"a"}`)
+	hiccuptest.Do(t, handler, get("/public", "Bearer a")).Text(`{"calls":3,"name":"a"}`).Header("Age", "0")
+	hiccuptest.Do(t, handler, get("/public", "Bearer b")).Text(`{"calls":4,"name":"a"}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/public")).Text(`{"calls":5,"name":"a"}`)
+
+	// field mask headers select different responses.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/public").Header("X-Fields", "name")).Text(`{"name":"a"}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/public")).Text(`{"calls":5,"name":"a"}`)
+}
+
+func TestCache_Middleware(t *testing.T) {
+	calls := 0
+	requireKey := func(next hiccup.HandlerFunc) hiccup.HandlerFunc {
+		return func(r *http.Request) *hiccup.Response {
+			if r.Header.Get("X-Api-Key") == "" {
+				return hiccup.Respond(http.StatusUnauthorized).SetBody("missing api key")
+			}
+			return next(r)
+		}
+	}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		return hiccup.Respond(http.StatusOK).
+			SetBody("private data").
+			SetHeader("Cache-Control", "max-age=60")
+	}).Use(requireKey, hiccup.RateLimit(hiccup.RateLimiter{
+		Limit:  2,
+		Window: time.Minute,
+		Key:    hiccup.RateLimitByHeader("X-Api-Key"),
+	})).SetCache(&hiccup.Cache{
+		Store: hiccup.NewLRUCacheStore(10),
+		Vary:  []string{"X-Api-Key"},
+	})
+
+	get := func(key string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", "/").Header("X-Api-Key", key)
+	}
+
+	hiccuptest.Do(t, handler, get("a")).Status(http.StatusOK).Header("RateLimit-Remaining", "1")
+
+	// stored responses pass through middleware.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Status(http.StatusUnauthorized)
+	hiccuptest.Do(t, handler, get("a")).
+		Status(http.StatusOK).
+		Header("Age", "0").
+		Header("RateLimit-Remaining", "0").
+		Text("private data")
+	hiccuptest.Do(t, handler, get("a")).Status(http.StatusTooManyRequests)
+	if calls != 1 {
+		t.Error("unexpected handler calls", calls)
+		t.FailNow()
+	}
+}
+
+func TestCache_Principal(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		res := hiccup.Respond(http.StatusOK).
+			SetBody("account of "+hiccup.Principal(r).(string)).
+			SetHeader("Cache-Control", "max-age=60")
+		if r.URL.Path == "/public" {
+			res.SetHeader("Cache-Control", "public, max-age=60")
+		}
+		return res
+	}).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{
+			hiccup.APIKeyAuth("X-API-Key", func(ctx context.Context, key string) (any, error) {
+				return "user-" + key, nil
+			}),
+		},
+	}).SetCache(&hiccup.Cache{Store: hiccup.NewLRUCacheStore(10)})
+
+	get := func(path string, key string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path).Header("X-API-Key", key)
+	}
+
+	// authenticated responses must be public to be stored.
+	hiccuptest.Do(t, handler, get("/", "alice")).Text("account of user-alice")
+	hiccuptest.Do(t, handler, get("/", "alice")).Header("Age", "").Text("account of user-alice")
+
+	// and are only sent to the same principal.
+	hiccuptest.Do(t, handler, get("/public", "alice")).Text("account of user-alice")
+	hiccuptest.Do(t, handler, get("/public", "alice")).Header("Age", "0").Text("account of user-alice")
+	hiccuptest.Do(t, handler, get("/public", "bob")).Header("Age", "").Text("account of user-bob")
+	if calls != 4 {
+		t.Error("unexpected handler calls", calls)
+		t.FailNow()
+	}
+}
+
+// countObserver counts the handler runs it observes.
+type countObserver struct {
+	hiccup.NopObserver
+	start atomic.Int32
+	end   atomic.Int32
+}
+
+func (o *countObserver) HandlerStart(ctx context.Context, r *http.Request) context.Context {
+	o.start.Add(1)
+	return ctx
+}
+
+func (o *countObserver) HandlerEnd(ctx context.Context, res *hiccup.Response) {
+	o.end.Add(1)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		n := calls.Add(1)
+		if n > 1 {
+			defer func() { refreshed <- struct{}{} }()
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(strconv.Itoa(int(n)))
+	}).SetCache(&hiccup.Cache{
+		Store:                hiccup.NewLRUCacheStore(10),
+		TTL:                  10 * time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})
+	o := new(countObserver)
+	handler.SetObserver(o)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Text("1")
+	time.Sleep(20 * time.Millisecond)
+
+	// the stale response is served while it is refreshed.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Text("1")
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Error("stale response not refreshed")
+		t.FailNow()
+	}
+
+	// give the refresh time to be stored after the handler returned.
+	time.Sleep(10 * time.Millisecond)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Text("2")
+
+	// background refreshes are observed like any other handler run.
+	if o.start.Load() != 4 || o.end.Load() != 4 {
+		t.Error("unexpected observed handler runs", o.start.Load(), o.end.Load())
+		t.FailNow()
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	ctx := context.Background()
+	s := hiccup.NewLRUCacheStore(2)
+	entry := func(body string, ttl time.Duration) *hiccup.CacheEntry {
+		return &hiccup.CacheEntry{Body: []byte(body), StaleUntil: time.Now().Add(ttl)}
+	}
+
+	s.Set(ctx, "a", entry("a", time.Minute))
+	s.Set(ctx, "b", entry("b", time.Minute))
+	s.Get(ctx, "a")
+	s.Set(ctx, "c", entry("c", time.Minute))
+
+	if e, _ := s.Get(ctx, "b"); e != nil {
+		t.Error("least recently used entry not evicted")
+		t.FailNow()
+	}
+	if e, _ := s.Get(ctx, "a"); e == nil || string(e.Body) != "a" {
+		t.Error("recently used entry evicted")
+		t.FailNow()
+	}
+
+	s.Set(ctx, "c", entry("c", -time.Second))
+	if e, _ := s.Get(ctx, "c"); e != nil || s.Len() != 1 {
+		t.Error("expired entry returned", s.Len())
+		t.FailNow()
+	}
+	s.Delete(ctx, "a")
+	if s.Len() != 0 {
+		t.Error("entry not deleted")
+		t.FailNow()
+	}
+}
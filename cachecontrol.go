@@ -0,0 +1,202 @@
+package hiccup
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+CacheControl describes a "Cache-Control" response header. Zero durations
+are omitted, set NoCache to require revalidation instead of a zero max age.
+
+See [Response.SetCacheControl].
+*/
+type CacheControl struct {
+	// How long the response is fresh, the "max-age" directive.
+	MaxAge time.Duration
+	// How long the response is fresh in shared caches, the "s-maxage"
+	// directive.
+	SMaxAge time.Duration
+	// How long a stale response can be served while it is refreshed, the
+	// "stale-while-revalidate" directive.
+	StaleWhileRevalidate time.Duration
+	// How long a stale response can be served if refreshing it fails, the
+	// "stale-if-error" directive.
+	StaleIfError time.Duration
+	// The response can be stored by shared caches.
+	Public bool
+	// The response can only be stored by the client.
+	Private bool
+	// The response must be revalidated before it is served from a cache.
+	NoCache bool
+	// The response must not be stored.
+	NoStore bool
+	// The response never changes while fresh.
+	Immutable bool
+}
+
+/*
+String returns the "Cache-Control" header value.
+*/
+func (cc CacheControl) String() string {
+	return formatCacheControl(cc.directives())
+}
+
+func (cc CacheControl) directives() map[string]string {
+	d := make(map[string]string)
+	flags := []struct {
+		name string
+		set  bool
+	}{
+		{"public", cc.Public},
+		{"private", cc.Private},
+		{"no-cache", cc.NoCache},
+		{"no-store", cc.NoStore},
+		{"immutable", cc.Immutable},
+	}
+	for _, f := range flags {
+		if f.set {
+			d[f.name] = ""
+		}
+	}
+	ages := []struct {
+		name string
+		v    time.Duration
+	}{
+		{"max-age", cc.MaxAge},
+		{"s-maxage", cc.SMaxAge},
+		{"stale-while-revalidate", cc.StaleWhileRevalidate},
+		{"stale-if-error", cc.StaleIfError},
+	}
+	for _, a := range ages {
+		if a.v > 0 {
+			d[a.name] = strconv.Itoa(int(a.v.Seconds()))
+		}
+	}
+	return d
+}
+
+/*
+Set the "Cache-Control" header of the response. It is merged with any
+value already set, by the handler or a [Middleware], keeping the most
+restrictive of both: directives like "private" or "no-store" are kept, the
+shortest duration of each directive is kept, "public" is dropped for
+private responses, and "immutable" is dropped for responses which must not
+be stored or must be revalidated.
+*/
+func (r *Response) SetCacheControl(cc CacheControl) *Response {
+	d := cc.directives()
+	for k, v := range r.Headers {
+		if http.CanonicalHeaderKey(k) != "Cache-Control" {
+			continue
+		}
+		d = mergeCacheControl(d, parseCacheControl(v))
+		delete(r.Headers, k)
+	}
+	return r.SetHeader("Cache-Control", formatCacheControl(d))
+}
+
+/*
+mergeCacheControl merges two sets of directives, keeping the most
+restrictive of both.
+*/
+func mergeCacheControl(a, b map[string]string) map[string]string {
+	for k, v := range b {
+		prev, ok := a[k]
+		if !ok {
+			a[k] = v
+			continue
+		}
+		x, errX := strconv.Atoi(prev)
+		y, errY := strconv.Atoi(v)
+		if errX == nil && errY == nil && y < x {
+			a[k] = v
+		}
+	}
+	if _, ok := a["private"]; ok {
+		delete(a, "public")
+	}
+	for _, k := range []string{"no-store", "no-cache"} {
+		if _, ok := a[k]; ok {
+			delete(a, "immutable")
+		}
+	}
+	return a
+}
+
+/*
+cacheDirectives is the order of known directives in "Cache-Control" header
+values. Other directives follow in alphabetical order.
+*/
+var cacheDirectives = []string{
+	"public",
+	"private",
+	"no-cache",
+	"no-store",
+	"max-age",
+	"s-maxage",
+	"stale-while-revalidate",
+	"stale-if-error",
+	"immutable",
+}
+
+func formatCacheControl(d map[string]string) string {
+	names := make([]string, 0, len(d))
+	for k := range d {
+		names = append(names, k)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		i, j := slices.Index(cacheDirectives, a), slices.Index(cacheDirectives, b)
+		switch {
+		case i >= 0 && j >= 0:
+			return i - j
+		case i >= 0:
+			return -1
+		case j >= 0:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	parts := make([]string, len(names))
+	for i, k := range names {
+		parts[i] = k
+		if v := d[k]; v != "" {
+			if strings.ContainsAny(v, " ,") {
+				v = strconv.Quote(v)
+			}
+			parts[i] += "=" + v
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+/*
+parseCacheControl returns the directives of a "Cache-Control" header value,
+with lower case names and unquoted values.
+*/
+func parseCacheControl(v string) map[string]string {
+	cc := make(map[string]string)
+	for _, d := range strings.Split(v, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func seconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,118 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleResponse_SetCacheControl() {
+	res := hiccup.Respond(http.StatusOK).
+		SetHeader("Cache-Control", "private, max-age=30").
+		SetCacheControl(hiccup.CacheControl{
+			MaxAge:       time.Hour,
+			Public:       true,
+			StaleIfError: time.Minute,
+		})
+	fmt.Println(res.Headers["Cache-Control"])
+	// Output: private, max-age=30, stale-if-error=60
+}
+
+func TestCacheControl_String(t *testing.T) {
+	tests := []struct {
+		cc   hiccup.CacheControl
+		want string
+	}{
+		{hiccup.CacheControl{}, ""},
+		{hiccup.CacheControl{NoStore: true}, "no-store"},
+		{
+			hiccup.CacheControl{MaxAge: time.Minute, SMaxAge: time.Hour, Public: true, Immutable: true},
+			"public, max-age=60, s-maxage=3600, immutable",
+		},
+		{
+			hiccup.CacheControl{Private: true, MaxAge: 90 * time.Second, StaleWhileRevalidate: 10 * time.Second},
+			"private, max-age=90, stale-while-revalidate=10",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.cc.String(); got != tt.want {
+			t.Error("cache control is", got, "want", tt.want)
+			t.FailNow()
+		}
+	}
+}
+
+func TestResponse_SetCacheControl(t *testing.T) {
+	tests := []struct {
+		header string
+		cc     hiccup.CacheControl
+		want   string
+	}{
+		{"", hiccup.CacheControl{MaxAge: time.Minute}, "max-age=60"},
+		{"max-age=600, s-maxage=30", hiccup.CacheControl{MaxAge: time.Minute, SMaxAge: time.Hour}, "max-age=60, s-maxage=30"},
+		{"private", hiccup.CacheControl{Public: true, MaxAge: time.Minute}, "private, max-age=60"},
+		{"no-store", hiccup.CacheControl{MaxAge: time.Minute, Immutable: true}, "no-store, max-age=60"},
+		{"must-revalidate, max-age=0", hiccup.CacheControl{MaxAge: time.Minute}, "max-age=0, must-revalidate"},
+	}
+	for _, tt := range tests {
+		res := hiccup.Respond(http.StatusOK)
+		if tt.header != "" {
+			res.SetHeader("cache-control", tt.header)
+		}
+		res.SetCacheControl(tt.cc)
+		if len(res.Headers) != 1 || res.Headers["Cache-Control"] != tt.want {
+			t.Error("merged cache control is", res.Headers, "want", tt.want)
+			t.FailNow()
+		}
+	}
+
+	// middleware can only restrict the caching of handler responses.
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).
+			SetBody("ok").
+			SetCacheControl(hiccup.CacheControl{Public: true, MaxAge: time.Hour})
+	}).Use(func(next hiccup.HandlerFunc) hiccup.HandlerFunc {
+		return func(r *http.Request) *hiccup.Response {
+			return next(r).SetCacheControl(hiccup.CacheControl{Private: true})
+		}
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Header("Cache-Control", "private, max-age=3600")
+}
+
+func TestResponseHandler_Vary(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		res := hiccup.Respond(http.StatusOK).SetBody(map[string]string{"a": "b"})
+		if r.URL.Path == "/lang" {
+			res.SetHeader("Vary", "Accept-Language, accept")
+		}
+		return res
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("image/png", json.Marshal),
+	)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Header("Vary", "Accept")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("image/png")).
+		Header("Vary", "Accept")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/lang")).
+		Header("Vary", "Accept-Language, accept")
+
+	_, header := handler.Invoke(httptestRequest("GET", "/"))
+	if header.Get("Vary") != "Accept" {
+		t.Error("invoke vary header is", header.Get("Vary"))
+		t.FailNow()
+	}
+
+	text := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("ok")
+	})
+	hiccuptest.Do(t, text, hiccuptest.NewRequest("GET", "/")).
+		Header("Vary", "Accept-Charset")
+}
@@ -0,0 +1,294 @@
+package hiccup
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnknownCharset is returned for request bodies of an unregistered charset.
+var ErrUnknownCharset = errors.New("hiccup: unknown charset")
+
+/*
+Charset transcodes text between a character encoding and UTF-8.
+
+Request bodies sent with a "charset" parameter in the "Content-Type" header
+are decoded to UTF-8 before they are unmarshaled, and text responses are
+encoded with the charset negotiated from the "Accept-Charset" header. See
+[RegisterCharset].
+*/
+type Charset interface {
+	// Canonical charset name, like "iso-8859-1".
+	Name() string
+	// Decode converts text in the charset to UTF-8.
+	Decode(b []byte) ([]byte, error)
+	// Encode converts UTF-8 text to the charset.
+	Encode(b []byte) ([]byte, error)
+}
+
+var charsets = struct {
+	sync.RWMutex
+	m map[string]Charset
+}{m: make(map[string]Charset)}
+
+/*
+RegisterCharset adds a [Charset] to the charset table under its name and
+any aliases. Names are matched case insensitively, and registering an
+existing name replaces it.
+
+The table includes "utf-8", "us-ascii", "iso-8859-1", "iso-8859-15",
+"windows-1252", "utf-16", "utf-16be" and "utf-16le" by default. Encoding
+text with runes which cannot be represented in a single-byte charset
+returns an error.
+*/
+func RegisterCharset(c Charset, aliases ...string) {
+	charsets.Lock()
+	defer charsets.Unlock()
+	for _, name := range append([]string{c.Name()}, aliases...) {
+		charsets.m[strings.ToLower(name)] = c
+	}
+}
+
+/*
+LookupCharset returns the [Charset] registered for a name or alias, or nil
+if there is none.
+*/
+func LookupCharset(name string) Charset {
+	charsets.RLock()
+	defer charsets.RUnlock()
+	return charsets.m[strings.ToLower(strings.TrimSpace(name))]
+}
+
+func init() {
+	RegisterCharset(utf8Charset{}, "utf8")
+	RegisterCharset(newSingleByte("us-ascii", asciiHigh()), "ascii", "us", "iso646-us")
+	RegisterCharset(newSingleByte("iso-8859-1", nil), "iso_8859-1", "latin1", "l1", "iso8859-1")
+	RegisterCharset(newSingleByte("iso-8859-15", map[byte]rune{
+		0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž', 0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+	}), "iso_8859-15", "latin-9", "latin9", "iso8859-15")
+	RegisterCharset(newSingleByte("windows-1252", map[byte]rune{
+		0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+		0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+		0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+		0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+	}), "cp1252", "x-cp1252")
+	RegisterCharset(utf16Charset{name: "utf-16", bom: true}, "utf16")
+	RegisterCharset(utf16Charset{name: "utf-16be"})
+	RegisterCharset(utf16Charset{name: "utf-16le", little: true})
+}
+
+type utf8Charset struct{}
+
+func (utf8Charset) Name() string { return "utf-8" }
+
+func (utf8Charset) Decode(b []byte) ([]byte, error) { return b, nil }
+
+func (utf8Charset) Encode(b []byte) ([]byte, error) { return b, nil }
+
+/*
+singleByte is a charset which maps every byte to a single rune. Bytes below
+0x80 are ASCII.
+*/
+type singleByte struct {
+	name   string
+	high   [128]rune
+	encode map[rune]byte
+}
+
+/*
+newSingleByte returns a single-byte charset which maps bytes like
+ISO-8859-1, except for the passed overrides.
+*/
+func newSingleByte(name string, overrides map[byte]rune) *singleByte {
+	c := &singleByte{name: name, encode: make(map[rune]byte)}
+	for i := range c.high {
+		c.high[i] = rune(0x80 + i)
+	}
+	for b, r := range overrides {
+		c.high[b-0x80] = r
+	}
+	for i, r := range c.high {
+		if r != utf8.RuneError {
+			c.encode[r] = byte(0x80 + i)
+		}
+	}
+	return c
+}
+
+func asciiHigh() map[byte]rune {
+	m := make(map[byte]rune)
+	for b := 0x80; b <= 0xff; b++ {
+		m[byte(b)] = utf8.RuneError
+	}
+	return m
+}
+
+func (c *singleByte) Name() string { return c.name }
+
+func (c *singleByte) Decode(b []byte) ([]byte, error) {
+	out := make([]byte, 0, len(b))
+	for _, x := range b {
+		if x < 0x80 {
+			out = append(out, x)
+			continue
+		}
+		out = utf8.AppendRune(out, c.high[x-0x80])
+	}
+	return out, nil
+}
+
+func (c *singleByte) Encode(b []byte) ([]byte, error) {
+	out := make([]byte, 0, len(b))
+	for _, r := range string(b) {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		} else if x, ok := c.encode[r]; ok {
+			out = append(out, x)
+		} else {
+			return nil, fmt.Errorf("hiccup: %q cannot be encoded in %s", r, c.name)
+		}
+	}
+	return out, nil
+}
+
+/*
+utf16Charset transcodes UTF-16 text. A leading byte order mark is removed
+when decoding, and sets the byte order of the "utf-16" charset, which is big
+endian otherwise. The "utf-16" charset is encoded with a byte order mark.
+*/
+type utf16Charset struct {
+	name   string
+	little bool
+	bom    bool
+}
+
+func (c utf16Charset) Name() string { return c.name }
+
+func (c utf16Charset) Decode(b []byte) ([]byte, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("hiccup: odd length %s text", c.name)
+	}
+
+	little := c.little
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xfe && b[1] == 0xff:
+			little, b = false, b[2:]
+		case b[0] == 0xff && b[1] == 0xfe:
+			little, b = true, b[2:]
+		}
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if little {
+			units[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+		} else {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+	}
+
+	out := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	return out, nil
+}
+
+func (c utf16Charset) Encode(b []byte) ([]byte, error) {
+	units := utf16.Encode([]rune(string(b)))
+	if c.bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if c.little {
+			out = append(out, byte(u), byte(u>>8))
+		} else {
+			out = append(out, byte(u>>8), byte(u))
+		}
+	}
+	return out, nil
+}
+
+/*
+isText reports whether a media type holds text which can be transcoded, like
+"text/plain" or "text/csv". Other types, like json which must be UTF-8, or
+xml which declares its own encoding, are not transcoded.
+*/
+func isText(m MediaType) bool {
+	return m.Type == "text"
+}
+
+/*
+negotiateCharset returns the charset to encode a text response with, or nil
+to send UTF-8. A charset sent as a parameter of the matched "Accept" media
+range takes precedence over the "Accept-Charset" header. Unknown charsets
+are skipped.
+*/
+func negotiateCharset(accept string, name string) Charset {
+	if name != "" {
+		if c := LookupCharset(name); c != nil {
+			return notUTF8(c)
+		}
+	}
+
+	type option struct {
+		name string
+		q    float64
+	}
+	var options []option
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		o := option{name: strings.TrimSpace(name), q: 1}
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				o.q = q
+			}
+		}
+		if o.name != "" && o.q > 0 {
+			options = append(options, o)
+		}
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].q > options[j].q
+	})
+
+	for _, o := range options {
+		if o.name == "*" {
+			return nil
+		}
+		if c := LookupCharset(o.name); c != nil {
+			return notUTF8(c)
+		}
+	}
+	return nil
+}
+
+func notUTF8(c Charset) Charset {
+	if _, ok := c.(utf8Charset); ok {
+		return nil
+	}
+	return c
+}
+
+/*
+withCharset returns a content type with its "charset" parameter set.
+*/
+func withCharset(contentType string, c Charset) string {
+	m := mediaTypeOf(contentType)
+	params := map[string]string{"charset": c.Name()}
+	for k, v := range m.Params {
+		if k != "charset" {
+			params[k] = v
+		}
+	}
+	m.Params = params
+	return m.String()
+}
@@ -0,0 +1,177 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleRegisterCharset() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("Grüße")
+	})
+
+	w, req := testRequest("GET", "/", nil)
+	req.Header.Set("Accept-Charset", "iso-8859-1, utf-8;q=0.5")
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Header().Get("Content-Type"))
+	fmt.Printf("% x\n", w.Body.Bytes())
+	// Output:
+	// text/plain; charset=iso-8859-1
+	// 47 72 fc df 65
+}
+
+func TestLookupCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		encoded []byte
+	}{
+		{"UTF-8", "Grüße", []byte("Grüße")},
+		{"latin1", "Grüße", []byte{'G', 'r', 0xfc, 0xdf, 'e'}},
+		{"ISO-8859-15", "5€", []byte{'5', 0xa4}},
+		{"windows-1252", "“5€”", []byte{0x93, '5', 0x80, 0x94}},
+		{"us-ascii", "Gruss", []byte("Gruss")},
+		{"utf-16", "hé", []byte{0xfe, 0xff, 0, 'h', 0, 0xe9}},
+		{"utf-16le", "h😀", []byte{'h', 0, 0x3d, 0xd8, 0x00, 0xde}},
+		{"utf-16be", "h", []byte{0, 'h'}},
+	}
+
+	for _, tt := range tests {
+		c := hiccup.LookupCharset(tt.name)
+		if c == nil {
+			t.Error("charset not found", tt.name)
+			t.FailNow()
+		}
+
+		b, err := c.Encode([]byte(tt.text))
+		if err != nil || !bytes.Equal(b, tt.encoded) {
+			t.Errorf("unexpected %s encoding % x %v", tt.name, b, err)
+			t.FailNow()
+		}
+		b, err = c.Decode(tt.encoded)
+		if err != nil || string(b) != tt.text {
+			t.Errorf("unexpected %s decoding %q %v", tt.name, b, err)
+			t.FailNow()
+		}
+	}
+
+	// runes which cannot be represented are not encoded.
+	if _, err := hiccup.LookupCharset("us-ascii").Encode([]byte("Grüße")); err == nil {
+		t.Error("expected an encoding error")
+		t.FailNow()
+	}
+
+	// a byte order mark overrides the default byte order.
+	b, _ := hiccup.LookupCharset("utf-16").Decode([]byte{0xff, 0xfe, 'h', 0})
+	if string(b) != "h" {
+		t.Error("byte order mark not applied", b)
+		t.FailNow()
+	}
+	if hiccup.LookupCharset("koi8-r") != nil {
+		t.Error("unexpected charset")
+		t.FailNow()
+	}
+}
+
+type rot13 struct{}
+
+func (rot13) Name() string { return "x-rot13" }
+
+func (rot13) Decode(b []byte) ([]byte, error) { return rot13{}.Encode(b) }
+
+func (rot13) Encode(b []byte) ([]byte, error) {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			c = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			c = 'A' + (c-'A'+13)%26
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+func TestHandler_Charset(t *testing.T) {
+	hiccup.RegisterCharset(rot13{}, "rot13")
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"msg": "Grüße"})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("text/plain", hiccup.MarshalText),
+		hiccup.WithEncoder("image/png", func(v any) ([]byte, error) { return []byte("png"), nil }),
+	)
+
+	tests := []struct {
+		accept        string
+		acceptCharset string
+		contentType   string
+		body          string
+	}{
+		{"text/plain", "", "text/plain", "map[msg:Grüße]"},
+		{"text/plain", "utf-8, iso-8859-1", "text/plain", "map[msg:Grüße]"},
+		{"text/plain", "koi8-r, rot13;q=0.8, *;q=0.1", "text/plain; charset=x-rot13", "znc[zft:Teüßr]"},
+		{"text/plain", "utf-8;q=0, koi8-r", "text/plain", "map[msg:Grüße]"},
+		{"text/plain; charset=latin1", "utf-8", "text/plain; charset=iso-8859-1", "map[msg:Gr\xfc\xdfe]"},
+		// text which cannot be represented is sent as UTF-8.
+		{"text/plain", "us-ascii", "text/plain; charset=utf-8", "map[msg:Grüße]"},
+		// json is always sent as UTF-8.
+		{"application/json", "iso-8859-1", "application/json", `{"msg":"Grüße"}`},
+		{"application/json; charset=latin1", "", "application/json", `{"msg":"Grüße"}`},
+		{"image/png", "iso-8859-1", "image/png", "png"},
+	}
+
+	for _, tt := range tests {
+		req := hiccuptest.NewRequest("GET", "/").Accept(tt.accept)
+		if tt.acceptCharset != "" {
+			req.Header("Accept-Charset", tt.acceptCharset)
+		}
+		hiccuptest.Do(t, handler, req).
+			Status(http.StatusOK).
+			Header("Content-Type", tt.contentType).
+			Text(tt.body)
+	}
+}
+
+func TestRequestDecoder_Charset(t *testing.T) {
+	dec := hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal))
+
+	tests := []struct {
+		contentType string
+		body        []byte
+	}{
+		{"application/json; charset=ISO-8859-1", []byte("{\"msg\":\"Gr\xfc\xdfe\"}")},
+		{"application/json; charset=utf-16le", []byte{'{', 0, '"', 0, 'm', 0, 's', 0, 'g', 0, '"', 0, ':', 0, '"', 0, 'G', 0, 'r', 0, 0xfc, 0, 0xdf, 0, 'e', 0, '"', 0, '}', 0}},
+		{"application/json; charset=utf-8", []byte(`{"msg":"Grüße"}`)},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+
+		v := make(map[string]string)
+		b, err := dec.DecodeBody(req, &v)
+		if err != nil || v["msg"] != "Grüße" || string(b) != `{"msg":"Grüße"}` {
+			t.Error("unexpected decode", tt.contentType, v, string(b), err)
+			t.FailNow()
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json; charset=koi8-r")
+	if _, err := dec.DecodeBody(req, &map[string]string{}); !errors.Is(err, hiccup.ErrUnknownCharset) {
+		t.Error("expected unknown charset error", err)
+		t.FailNow()
+	}
+}
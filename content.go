@@ -0,0 +1,106 @@
+package hiccup
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+content is a seekable response body served without a [ResponseEncoder].
+*/
+type content struct {
+	io.ReadSeeker
+	name    string
+	modtime time.Time
+	closer  io.Closer
+}
+
+/*
+contentBody returns the content of [fs.File] and [io.ReadSeeker] response
+bodies. Files which cannot seek are read into memory.
+*/
+func contentBody(body any) (*content, bool, error) {
+	switch b := body.(type) {
+	case fs.File:
+		c := &content{closer: b}
+		if info, err := b.Stat(); err == nil {
+			c.name, c.modtime = info.Name(), info.ModTime()
+		}
+		if rs, ok := b.(io.ReadSeeker); ok {
+			c.ReadSeeker = rs
+			return c, true, nil
+		}
+		data, err := io.ReadAll(b)
+		if err != nil {
+			b.Close()
+			return nil, true, err
+		}
+		c.ReadSeeker = bytes.NewReader(data)
+		return c, true, nil
+	case io.ReadSeeker:
+		c := &content{ReadSeeker: b}
+		if n, ok := b.(interface{ Name() string }); ok {
+			c.name = n.Name()
+		}
+		if cl, ok := b.(io.Closer); ok {
+			c.closer = cl
+		}
+		return c, true, nil
+	}
+	return nil, false, nil
+}
+
+func isContent(body any) bool {
+	switch body.(type) {
+	case fs.File, io.ReadSeeker:
+		return true
+	}
+	return false
+}
+
+/*
+writeContent serves a seekable response body. Responses with a 200 status
+code support "Range" and "If-Range" requests, and respond with partial
+content as [http.ServeContent] does. The "Content-Type" is detected from the
+file name extension or the content if the response does not set one.
+*/
+func writeContent(w http.ResponseWriter, r *http.Request, res *Response, c *content) {
+	if c.closer != nil {
+		defer c.closer.Close()
+	}
+
+	if res.StatusCode == http.StatusOK {
+		http.ServeContent(w, r, c.name, c.modtime, c.ReadSeeker)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", detectContentType(c))
+	}
+	if size, err := c.Seek(0, io.SeekEnd); err == nil {
+		if _, err := c.Seek(0, io.SeekStart); err == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, c)
+	}
+}
+
+/*
+detectContentType sniffs the content type of seekable content with
+[http.DetectContentType], and seeks back to the start.
+*/
+func detectContentType(rs io.ReadSeeker) string {
+	var buf [512]byte
+	n, _ := io.ReadFull(rs, buf[:])
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(buf[:n])
+}
@@ -0,0 +1,137 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleHandler_file() {
+	files := fstest.MapFS{
+		"hello.txt": {Data: []byte("Hello World!"), ModTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		f, err := files.Open("hello.txt")
+		if err != nil {
+			return hiccup.Respond(http.StatusNotFound)
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(f)
+	})
+
+	w, req := testRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=6-")
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Code, w.Header().Get("Content-Range"), w.Body.String())
+	// Output: 206 bytes 6-11/12 World!
+}
+
+/*
+streamFile is a file which cannot seek.
+*/
+type streamFile struct {
+	io.Reader
+	closed bool
+}
+
+func (f *streamFile) Stat() (fs.FileInfo, error) {
+	return fstest.MapFS{"stream.txt": {}}.Stat("stream.txt")
+}
+
+func (f *streamFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestHandler_Content(t *testing.T) {
+	modtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"data.txt": {Data: []byte("0123456789"), ModTime: modtime},
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		f, err := files.Open("data.txt")
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(f)
+	}, hiccup.WithEncoder("application/json", testFailMarshal))
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("application/json")).
+		Status(http.StatusOK).
+		Header("Accept-Ranges", "bytes").
+		Header("Content-Length", "10").
+		ContentType("text/plain").
+		Text("0123456789")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=2-4")).
+		Status(http.StatusPartialContent).
+		Header("Content-Range", "bytes 2-4/10").
+		Header("Content-Length", "3").
+		Text("234")
+
+	res := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=0-1,8-")).
+		Status(http.StatusPartialContent)
+	if ct := res.Response.Header.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/byteranges") ||
+		!bytes.Contains(res.Body, []byte("01")) || !bytes.Contains(res.Body, []byte("89")) {
+		t.Error("unexpected multipart response", ct, string(res.Body))
+		t.FailNow()
+	}
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=20-")).
+		Status(http.StatusRequestedRangeNotSatisfiable).
+		Header("Content-Range", "bytes */10")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").
+		Header("Range", "bytes=2-4").
+		Header("If-Range", modtime.Add(-time.Hour).Format(http.TimeFormat))).
+		Status(http.StatusOK).
+		Text("0123456789")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").
+		Header("Range", "bytes=2-4").
+		Header("If-Range", modtime.Format(http.TimeFormat))).
+		Status(http.StatusPartialContent).
+		Text("234")
+}
+
+func TestHandler_ContentStream(t *testing.T) {
+	f := &streamFile{Reader: strings.NewReader("streamed")}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(f)
+	})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=0-5")).
+		Status(http.StatusPartialContent).
+		Text("stream")
+	if !f.closed {
+		t.Error("file not closed")
+		t.FailNow()
+	}
+
+	handler = hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusCreated).SetBody(bytes.NewReader([]byte("created")))
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=0-1")).
+		Status(http.StatusCreated).
+		ContentType("text/plain").
+		Header("Content-Length", "7").
+		Text("created")
+
+	_, header := handler.Invoke(httptestRequest("GET", "/"))
+	if header.Get("Accept-Ranges") != "" || header.Get("Content-Type") != "" {
+		t.Error("unexpected invoke headers", header)
+		t.FailNow()
+	}
+}
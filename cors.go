@@ -0,0 +1,224 @@
+package hiccup
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+CORS is a cross-origin resource sharing policy for a [ResponseHandler].
+
+Preflight requests are answered by the handler without running the
+[HandlerFunc], and the CORS headers of allowed origins are added to all
+other responses. Headers set by the [Response] are never overwritten, and
+"Origin" is merged with any other "Vary" header values.
+
+See [ResponseHandler.SetCORS].
+*/
+type CORS struct {
+	// Allowed origins, like "https://example.com". A "*" allows any origin,
+	// and a wildcard subdomain, like "https://*.example.com", allows any
+	// subdomain of the domain.
+	Origins []string
+	// AllowOrigin reports whether an origin which is not in Origins is
+	// allowed. Optional.
+	AllowOrigin func(origin string) bool
+	// Methods allowed in cross-origin requests. Defaults to the methods
+	// allowed by the handler, or to the common methods if they are not
+	// known.
+	Methods []string
+	// Request headers allowed in cross-origin requests. A "*" allows any
+	// header. The "Accept", "Accept-Language", "Content-Language" and
+	// "Content-Type" headers are always allowed.
+	Headers []string
+	// Allow requests with credentials, like cookies. The request origin is
+	// sent back instead of "*" if enabled. It cannot be combined with a "*"
+	// origin, which would let any site read responses with the credentials
+	// of its visitors; list the trusted origins instead.
+	Credentials bool
+	// Response headers exposed to clients.
+	ExposeHeaders []string
+	// How long preflight results can be cached. Not sent if zero.
+	MaxAge time.Duration
+}
+
+/*
+SetCORS sets the [CORS] policy of the handler. Passing nil disables CORS.
+
+SetCORS panics if the policy allows credentials from any origin, with a "*"
+origin and Credentials enabled.
+*/
+func (h *ResponseHandler) SetCORS(c *CORS) *ResponseHandler {
+	if c != nil && c.Credentials && slices.Contains(c.Origins, "*") {
+		panic("hiccup: CORS policy allows credentials from any origin")
+	}
+	h.cors = c
+	return h
+}
+
+var simpleHeaders = []string{"accept", "accept-language", "content-language", "content-type"}
+
+/*
+allowsOrigin reports whether a request origin is allowed by the policy.
+*/
+func (c *CORS) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, o := range c.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(strings.ToLower(o), "*"); ok {
+			sub := strings.ToLower(origin)
+			if len(sub) > len(prefix)+len(suffix) && strings.HasPrefix(sub, prefix) && strings.HasSuffix(sub, suffix) &&
+				!strings.ContainsAny(sub[len(prefix):len(sub)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return c.AllowOrigin != nil && c.AllowOrigin(origin)
+}
+
+/*
+allowOrigin sets the "Access-Control-Allow-Origin" and credentials headers
+for an allowed origin.
+*/
+func (c *CORS) allowOrigin(header http.Header, origin string) {
+	if slices.Contains(c.Origins, "*") {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+/*
+apply adds the CORS headers of an actual request to the response headers,
+keeping any already set.
+*/
+func (c *CORS) apply(header http.Header, r *http.Request) {
+	addVary(header, "Origin")
+	origin := r.Header.Get("Origin")
+	if header.Get("Access-Control-Allow-Origin") != "" || !c.allowsOrigin(origin) {
+		return
+	}
+
+	c.allowOrigin(header, origin)
+	if len(c.ExposeHeaders) > 0 && header.Get("Access-Control-Expose-Headers") == "" {
+		header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposeHeaders, ", "))
+	}
+}
+
+/*
+isPreflight reports whether a request is a CORS preflight request.
+*/
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+/*
+preflight returns the response to a preflight request. Requests which are
+not allowed are sent no CORS headers, so the browser rejects them.
+*/
+func (h *ResponseHandler) preflight(r *http.Request) *Response {
+	header := make(http.Header)
+	header.Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	methods := h.methods()
+	if methods == nil {
+		methods = defaultMethods
+	}
+	h.cors.allowPreflight(header, r, methods)
+
+	res := Respond(http.StatusNoContent)
+	for k := range header {
+		res.SetHeader(k, header.Get(k))
+	}
+	return res
+}
+
+/*
+allowPreflight sets the CORS headers of a preflight request if its origin,
+method and headers are allowed.
+*/
+func (c *CORS) allowPreflight(header http.Header, r *http.Request, handlerMethods []string) {
+	origin := r.Header.Get("Origin")
+	if !c.allowsOrigin(origin) {
+		return
+	}
+
+	methods := c.Methods
+	if methods == nil {
+		methods = handlerMethods
+	}
+	if !slices.Contains(methods, r.Header.Get("Access-Control-Request-Method")) {
+		return
+	}
+
+	var requested []string
+	for _, v := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			if !c.allowsHeader(v) {
+				return
+			}
+			requested = append(requested, v)
+		}
+	}
+
+	c.allowOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+}
+
+func (c *CORS) allowsHeader(name string) bool {
+	if slices.Contains(simpleHeaders, name) {
+		return true
+	}
+	for _, h := range c.Headers {
+		if h == "*" || strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+addVary merges values into the "Vary" header, skipping values already
+present.
+*/
+func addVary(header http.Header, values ...string) {
+	var vary []string
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				vary = append(vary, f)
+			}
+		}
+	}
+	if slices.Contains(vary, "*") {
+		return
+	}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !slices.ContainsFunc(vary, func(f string) bool { return strings.EqualFold(f, v) }) {
+			vary = append(vary, v)
+		}
+	}
+	if len(vary) > 0 {
+		header.Set("Vary", strings.Join(vary, ", "))
+	}
+}
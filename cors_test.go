@@ -0,0 +1,149 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleResponseHandler_SetCORS() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("Hello World!")
+	}).SetCORS(&hiccup.CORS{
+		Origins: []string{"https://*.example.com"},
+		Headers: []string{"Authorization"},
+		MaxAge:  time.Hour,
+	})
+
+	w, req := testRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Code)
+	fmt.Println(w.Header().Get("Access-Control-Allow-Origin"))
+	fmt.Println(w.Header().Get("Access-Control-Allow-Headers"))
+	fmt.Println(w.Header().Get("Access-Control-Max-Age"))
+	// Output:
+	// 204
+	// https://app.example.com
+	// authorization, content-type
+	// 3600
+}
+
+func TestResponseHandler_SetCORS(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.Method == http.MethodOptions {
+			t.Error("handler called for preflight request")
+		}
+		res := hiccup.Respond(http.StatusOK).SetBody("ok").SetHeader("Vary", "Accept-Encoding")
+		if r.URL.Path == "/custom" {
+			res.SetHeader("Access-Control-Allow-Origin", "https://custom.test")
+		}
+		return res
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		Describe(hiccup.Operation{Method: http.MethodGet}).
+		Describe(hiccup.Operation{Method: http.MethodOptions}).
+		SetCORS(&hiccup.CORS{
+			Origins: []string{"https://app.test"},
+			AllowOrigin: func(origin string) bool {
+				return strings.HasSuffix(origin, ".local")
+			},
+			Credentials:   true,
+			ExposeHeaders: []string{"X-Total-Count"},
+		})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Origin", "https://app.test")).
+		Status(http.StatusOK).
+		Header("Access-Control-Allow-Origin", "https://app.test").
+		Header("Access-Control-Allow-Credentials", "true").
+		Header("Access-Control-Expose-Headers", "X-Total-Count").
+		Header("Vary", "Accept-Encoding, Origin, Accept")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Origin", "http://dev.local")).
+		Header("Access-Control-Allow-Origin", "http://dev.local")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Origin", "https://evil.test")).
+		Status(http.StatusOK).
+		Header("Access-Control-Allow-Origin", "").
+		Header("Vary", "Accept-Encoding, Origin, Accept")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/custom").Header("Origin", "https://app.test")).
+		Header("Access-Control-Allow-Origin", "https://custom.test").
+		Header("Access-Control-Allow-Credentials", "")
+
+	preflight := func(origin, method, headers string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("OPTIONS", "/").
+			Header("Origin", origin).
+			Header("Access-Control-Request-Method", method).
+			Header("Access-Control-Request-Headers", headers)
+	}
+
+	hiccuptest.Do(t, handler, preflight("https://app.test", "GET", "Content-Type")).
+		Status(http.StatusNoContent).
+		Header("Access-Control-Allow-Origin", "https://app.test").
+		Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS").
+		Header("Access-Control-Allow-Headers", "content-type").
+		Header("Access-Control-Max-Age", "").
+		Header("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	for _, req := range []*hiccuptest.Request{
+		preflight("https://evil.test", "GET", ""),
+		preflight("https://app.test", "DELETE", ""),
+		preflight("https://app.test", "GET", "X-Secret"),
+	} {
+		hiccuptest.Do(t, handler, req).
+			Status(http.StatusNoContent).
+			Header("Access-Control-Allow-Origin", "").
+			Header("Access-Control-Allow-Methods", "")
+	}
+}
+
+func TestCORS_Origins(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		allowed string
+	}{
+		{[]string{"*"}, "https://any.test", "*"},
+		{[]string{"https://*.example.com"}, "https://a.b.example.com", "https://a.b.example.com"},
+		{[]string{"https://*.example.com"}, "https://example.com", ""},
+		{[]string{"https://*.example.com"}, "http://app.example.com", ""},
+		{[]string{"https://*.example.com"}, "https://evil.test/.example.com", ""},
+		{[]string{"HTTPS://App.Test"}, "https://app.test", "https://app.test"},
+	}
+
+	for _, tt := range tests {
+		handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK)
+		}).SetCORS(&hiccup.CORS{Origins: tt.origins})
+
+		_, header := handler.Invoke(httptestRequestWithOrigin(tt.origin))
+		if got := header.Get("Access-Control-Allow-Origin"); got != tt.allowed {
+			t.Error("unexpected allowed origin", tt.origins, tt.origin, got)
+			t.FailNow()
+		}
+	}
+}
+
+func httptestRequestWithOrigin(origin string) *http.Request {
+	r := httptestRequest("GET", "/")
+	r.Header.Set("Origin", origin)
+	return r
+}
+
+func TestResponseHandler_SetCORSCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for credentials from any origin")
+		}
+	}()
+	hiccup.Handler(nil).SetCORS(&hiccup.CORS{Origins: []string{"*"}, Credentials: true})
+}
@@ -0,0 +1,132 @@
+package hiccup
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+/*
+Envelope wraps the body of a [Response] before it is encoded. It is passed
+the request being served and the response, and returns the body to encode.
+Request metadata is available with functions like [RequestID] and
+[Negotiated].
+
+See [ResponseHandler.SetEnvelope] and [DataEnvelope].
+*/
+type Envelope func(r *http.Request, res *Response) any
+
+/*
+SetEnvelope sets the [Envelope] response bodies are wrapped in. Passing nil
+sends bare bodies.
+
+Only bodies encoded with a [ResponseEncoder] or as plain text are wrapped.
+Raw and file bodies, redirects, and responses with a status code which
+does not allow a body are sent as is. [ResponseHandler.Invoke] returns the
+body before it is wrapped.
+*/
+func (h *ResponseHandler) SetEnvelope(e Envelope) *ResponseHandler {
+	h.envelope = e
+	return h
+}
+
+/*
+EnvelopeBody is the response body of the [DataEnvelope].
+*/
+type EnvelopeBody struct {
+	// Response body of a successful response.
+	Data any `json:"data,omitempty" yaml:"data,omitempty"`
+	// Metadata of the response, like the request ID or page parameters.
+	Meta map[string]any `json:"meta,omitempty" yaml:"meta,omitempty"`
+	// Response bodies of a 4XX or 5XX response.
+	Errors []any `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+/*
+DataEnvelope is an [Envelope] which wraps response bodies in an
+[EnvelopeBody]. Bodies of successful responses are sent as data, and bodies
+of 4XX and 5XX responses as errors. The items of a [Page] are sent as data,
+with its limit, offset and total as metadata, and the [RequestID] is sent
+as metadata if enabled.
+*/
+func DataEnvelope(r *http.Request, res *Response) any {
+	e := &EnvelopeBody{Meta: make(map[string]any)}
+	body := res.Body
+	if p, ok := body.(pageEnvelope); ok {
+		body = p.envelope(e.Meta)
+	}
+	if id := RequestID(r); id != "" {
+		e.Meta["request_id"] = id
+	}
+
+	switch {
+	case res.StatusCode >= 400 && body != nil:
+		e.Errors = []any{body}
+	case res.StatusCode < 400:
+		e.Data = body
+	}
+	if len(e.Meta) == 0 {
+		e.Meta = nil
+	}
+	return e
+}
+
+/*
+pageEnvelope is implemented by page bodies, to send their items as data and
+their page parameters as metadata.
+*/
+type pageEnvelope interface {
+	envelope(meta map[string]any) any
+}
+
+/*
+wrap returns the response with its body wrapped in the envelope of the
+handler, if it is encoded.
+*/
+func (h *ResponseHandler) wrap(r *http.Request, res *Response) *Response {
+	if h.envelope == nil || isRedirect(res) || !bodyAllowed(res.StatusCode) {
+		return res
+	}
+	if _, ok := res.Body.(*RawBody); ok || isContent(res.Body) {
+		return res
+	}
+	cp := *res
+	cp.Body = h.envelope(r, res)
+	return &cp
+}
+
+/*
+SetEnvelope sets the name of the member request bodies are wrapped in, like
+"data", for clients which send enveloped payloads. The value of the member
+is decoded into the value passed to DecodeBody, and validated against its
+schema if schemas are set. Bodies without the member do not modify the
+value, and are rejected with a [ValidationError] if schemas are set.
+Passing an empty string decodes bare bodies.
+*/
+func (r *RequestDecoder) SetEnvelope(member string) *RequestDecoder {
+	r.envelope = member
+	return r
+}
+
+/*
+unmarshal decodes a body into v, unwrapping it from the envelope member if
+set.
+*/
+func (r *RequestDecoder) unmarshal(dec BodyDecoder, b []byte, v any) error {
+	if r.envelope == "" {
+		return dec.Unmarshal(b, v)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decoding enveloped body into non-pointer %T", v)
+	}
+
+	tag := fmt.Sprintf(`json:%[1]q yaml:%[1]q xml:%[1]q`, r.envelope)
+	wrapper := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "Data",
+		Type: rv.Type(),
+		Tag:  reflect.StructTag(tag),
+	}}))
+	wrapper.Elem().Field(0).Set(rv)
+	return dec.Unmarshal(b, wrapper.Interface())
+}
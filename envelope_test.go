@@ -0,0 +1,123 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleResponseHandler_SetEnvelope() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Path == "/missing" {
+			return hiccup.RespondProblem(http.StatusNotFound, "no such article")
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"title": "Hello"})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetEnvelope(hiccup.DataEnvelope)
+
+	for _, path := range []string{"/", "/missing"} {
+		w, req := testRequest("GET", path, nil)
+		handler.ServeHTTP(w, req)
+		fmt.Println(w.Body.String())
+	}
+	// Output:
+	// {"data":{"title":"Hello"}}
+	// {"errors":[{"title":"Not Found","status":404,"detail":"no such article"}]}
+}
+
+func TestResponseHandler_SetEnvelope(t *testing.T) {
+	paginator := &hiccup.Paginator{}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		switch r.URL.Path {
+		case "/list":
+			page, _ := paginator.Parse(r)
+			return hiccup.NewPage(page, []string{"a", "b"}, 2).Respond(http.StatusOK)
+		case "/raw":
+			return hiccup.Respond(http.StatusOK).SetRaw("text/plain", []byte("raw"))
+		case "/redirect":
+			return hiccup.Respond(http.StatusFound).SetRedirectURI("/list")
+		}
+		return hiccup.Respond(http.StatusOK).SetBody("ok")
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetEnvelope(hiccup.DataEnvelope).SetRequestID("X-Request-ID")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?limit=5").Header("X-Request-ID", "r1")).
+		Status(http.StatusOK).
+		JSONPath("", map[string]any{
+			"data": []string{"a", "b"},
+			"meta": map[string]any{"limit": 5, "offset": 0, "total": 2, "request_id": "r1"},
+		})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("application/yaml").Header("X-Request-ID", "r2")).
+		Text("data: ok\nmeta:\n    request_id: r2\n")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/raw")).Text("raw")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/redirect")).Header("Location", "/list")
+
+	res, _ := handler.Invoke(httptestRequest("GET", "/"))
+	if res.Body != "ok" {
+		t.Error("invoke body wrapped", res.Body)
+		t.FailNow()
+	}
+
+	// custom envelopes have access to the response status.
+	handler.SetEnvelope(func(r *http.Request, res *hiccup.Response) any {
+		return map[string]any{"status": res.StatusCode, "body": res.Body}
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Text(`{"body":"ok","status":200}`)
+}
+
+func TestRequestDecoder_SetEnvelope(t *testing.T) {
+	type message struct {
+		Text string `json:"text" yaml:"text"`
+	}
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+	).SetEnvelope("data")
+
+	var m message
+	_, req := testRequest("POST", "/", bytes.NewBufferString(`{"data": {"text": "Hello"}, "meta": {}}`))
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Text != "Hello" {
+		t.Error("unexpected json decode result", err, m)
+		t.FailNow()
+	}
+
+	m = message{}
+	_, req = testRequest("POST", "/", bytes.NewBufferString("data:\n  text: Hi\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Text != "Hi" {
+		t.Error("unexpected yaml decode result", err, m)
+		t.FailNow()
+	}
+
+	m = message{}
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"text": "bare"}`))
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Text != "" {
+		t.Error("bare body decoded", err, m)
+		t.FailNow()
+	}
+
+	// schemas validate the enveloped value.
+	dec.SetSchemas(hiccup.NewSchemaRegistry())
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"data": {"text": 1}}`))
+	var verr *hiccup.ValidationError
+	if _, err := dec.DecodeBody(req, &m); !errors.As(err, &verr) || verr.Errors[0].Pointer != "/text" {
+		t.Error("expected a validation error", err)
+		t.FailNow()
+	}
+
+	// and reject bodies without the envelope member.
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"text": "bare"}`))
+	if _, err := dec.DecodeBody(req, &m); !errors.As(err, &verr) || verr.Errors[0].Error() != "/data: is required" {
+		t.Error("expected a missing envelope error", err)
+		t.FailNow()
+	}
+}
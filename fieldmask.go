@@ -0,0 +1,283 @@
+package hiccup
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+FieldMask configures the response fields clients can select, so only the
+selected fields of a response body are sent.
+
+Fields are selected with a comma separated list of paths, like
+"id,name,owner.email", where nested fields are separated by dots. Paths
+match the names of struct fields for the negotiated encoder, following
+their json or yaml tags, and the keys of maps with string keys, and apply to every item of slices and arrays and of [Page]
+items. Paths which match no field are ignored. Fields of types with their
+own marshaler for the negotiated encoder, like a MarshalJSON method, are
+selected from the value they marshal to.
+
+See [ResponseHandler.SetFieldMask].
+*/
+type FieldMask struct {
+	// Query parameter the fields are read from. Defaults to "fields".
+	Param string
+	// Header the fields are read from if there is no query parameter, like
+	// the "X-Goog-FieldMask" header of Google APIs. Headers are not read if
+	// empty.
+	Header string
+}
+
+/*
+SetFieldMask enables field selection for response bodies with the passed
+[FieldMask] settings. Passing nil disables it.
+
+The mask is applied to the body of 2XX responses before it is encoded, so
+it applies the same way for every encoder. Raw and file bodies are sent as
+is, and an [Envelope] wraps the masked body.
+*/
+func (h *ResponseHandler) SetFieldMask(f *FieldMask) *ResponseHandler {
+	h.fieldMask = f
+	return h
+}
+
+/*
+fields returns the field mask sent with a request, or nil if there is none.
+*/
+func (f *FieldMask) fields(r *http.Request) fieldMask {
+	param := f.Param
+	if param == "" {
+		param = "fields"
+	}
+	v := r.URL.Query().Get(param)
+	if v == "" && f.Header != "" {
+		v = r.Header.Get(f.Header)
+	}
+	return parseFieldMask(v)
+}
+
+/*
+fieldMask is a tree of selected field names. Fields selected as a whole
+map to nil.
+*/
+type fieldMask map[string]fieldMask
+
+func parseFieldMask(v string) fieldMask {
+	var m fieldMask
+	for _, path := range strings.Split(v, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if m == nil {
+			m = make(fieldMask)
+		}
+		node := m
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			child, ok := node[name]
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if ok && child == nil {
+				// the parent field is selected as a whole.
+				break
+			}
+			if child == nil {
+				child = make(fieldMask)
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return m
+}
+
+/*
+mask returns the response with its body reduced to the fields selected in
+the request.
+*/
+func (h *ResponseHandler) mask(r *http.Request, res *Response) *Response {
+	if h.fieldMask == nil || res.StatusCode < 200 || res.StatusCode >= 300 || res.Body == nil {
+		return res
+	}
+	if _, ok := res.Body.(*RawBody); ok || isContent(res.Body) {
+		return res
+	}
+	m := h.fieldMask.fields(r)
+	if m == nil {
+		return res
+	}
+
+	cp := *res
+	tag := schemaTag(Negotiated(r).String())
+	if p, ok := res.Body.(pageMask); ok {
+		cp.Body = p.mask(func(v any) any { return m.apply(reflect.ValueOf(v), tag).Interface() })
+	} else {
+		cp.Body = m.apply(reflect.ValueOf(res.Body), tag).Interface()
+	}
+	return &cp
+}
+
+/*
+pageMask is implemented by page bodies, to apply a field mask to their
+items instead of the page.
+*/
+type pageMask interface {
+	mask(f func(v any) any) any
+}
+
+/*
+apply returns a copy of v with only the selected fields. Structs are copied
+to struct types with only the selected fields, keeping their tags, and maps
+and slices are copied to map[string]any and []any values. Values with a
+marshaler of the encoder for the schema tag are not copied, since their
+methods would be lost, and fields are selected from the value they marshal
+to instead.
+*/
+func (m fieldMask) apply(v reflect.Value, tag string) reflect.Value {
+	if m == nil || !v.IsValid() {
+		return v
+	}
+	for {
+		if out, ok := marshaled(v, tag); ok {
+			if mv := reflect.ValueOf(out); mv.Kind() == reflect.Map || mv.Kind() == reflect.Slice {
+				return m.apply(mv, tag)
+			}
+			return v
+		}
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			break
+		}
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var fields []structField
+		var values []reflect.Value
+		for _, f := range structFields(v.Type(), tag) {
+			sub, ok := m[f.Name]
+			if !ok {
+				continue
+			}
+			fv, err := v.FieldByIndexErr(f.Index)
+			if err != nil {
+				// a promoted field of a nil embedded pointer.
+				continue
+			}
+			fields = append(fields, f)
+			values = append(values, sub.apply(fv, tag))
+		}
+		return newStruct(fields, values)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		out := make(map[string]any)
+		for name, sub := range m {
+			if ev := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); ev.IsValid() {
+				out[name] = sub.apply(ev, tag).Interface()
+			}
+		}
+		return reflect.ValueOf(out)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = m.apply(v.Index(i), tag).Interface()
+		}
+		return reflect.ValueOf(out)
+	}
+	return v
+}
+
+// yamlMarshaler is the Marshaler interface of yaml packages.
+type yamlMarshaler interface {
+	MarshalYAML() (any, error)
+}
+
+/*
+marshaled returns the generic value a value with its own marshaler for the
+encoder of the schema tag marshals to, with json values decoded to maps and
+slices, and reports whether it has one. Values failing to marshal return a
+nil value, so they are encoded as is and the encoder reports the error.
+*/
+func marshaled(v reflect.Value, tag string) (any, bool) {
+	if !v.CanInterface() || (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, false
+	}
+	i := v.Interface()
+	if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface && v.CanAddr() {
+		// encoders call the pointer methods of addressable values.
+		i = v.Addr().Interface()
+	}
+
+	if tag == "yaml" {
+		switch m := i.(type) {
+		case yamlMarshaler:
+			out, err := m.MarshalYAML()
+			if err != nil {
+				return nil, true
+			}
+			return out, true
+		case encoding.TextMarshaler:
+			return nil, true
+		}
+		return nil, false
+	}
+	switch i.(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+		b, err := json.Marshal(i)
+		if err != nil {
+			return nil, true
+		}
+		var out any
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		if err := d.Decode(&out); err != nil {
+			return nil, true
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+/*
+newStruct returns a value of a new struct type with the passed fields and
+values, keeping the names and tags of the fields. The types of the fields
+are those of the values.
+*/
+func newStruct(fields []structField, values []reflect.Value) reflect.Value {
+	sfs := make([]reflect.StructField, len(fields))
+	names := make(map[string]bool)
+	for i, f := range fields {
+		sf := f.Field
+		sf.Anonymous = false
+		sf.Index = nil
+		sf.Offset = 0
+		sf.Type = values[i].Type()
+		for names[sf.Name] {
+			// promoted fields of different embedded structs can share a Go
+			// name, and are told apart by their tags.
+			sf.Name += "_"
+		}
+		names[sf.Name] = true
+		sfs[i] = sf
+	}
+
+	out := reflect.New(reflect.StructOf(sfs)).Elem()
+	for i, v := range values {
+		out.Field(i).Set(v)
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+type owner struct {
+	Name  string `json:"name" yaml:"name"`
+	Email string `json:"email" yaml:"email"`
+}
+
+type audit struct {
+	Created string `json:"created_at" yaml:"createdAt"`
+}
+
+type project struct {
+	ID     int               `json:"id" yaml:"id"`
+	Name   string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Owner  *owner            `json:"owner" yaml:"owner"`
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	Tags   []string          `json:"tags" yaml:"tags"`
+	audit
+}
+
+func ExampleResponseHandler_SetFieldMask() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(project{
+			ID:    1,
+			Name:  "hiccup",
+			Owner: &owner{Name: "Ada", Email: "ada@example.com"},
+		})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetFieldMask(&hiccup.FieldMask{})
+
+	w, req := testRequest("GET", "/projects/1?fields=id,owner.email", nil)
+	handler.ServeHTTP(w, req)
+	fmt.Println(w.Body.String())
+	// Output: {"id":1,"owner":{"email":"ada@example.com"}}
+}
+
+func TestResponseHandler_SetFieldMask(t *testing.T) {
+	p := project{
+		ID:     1,
+		Name:   "hiccup",
+		Owner:  &owner{Name: "Ada", Email: "ada@example.com"},
+		Labels: map[string]string{"team": "api", "tier": "1"},
+		Tags:   []string{"go"},
+		audit:  audit{Created: "2024-01-01"},
+	}
+	paginator := &hiccup.Paginator{}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		switch r.URL.Path {
+		case "/list":
+			page, _ := paginator.Parse(r)
+			return hiccup.NewPage(page, []project{p, {ID: 2}}, 2).Respond(http.StatusOK)
+		case "/map":
+			return hiccup.Respond(http.StatusOK).SetBody(map[string]any{"id": 3, "owner": p.Owner, "extra": true})
+		case "/missing":
+			return hiccup.RespondProblem(http.StatusNotFound, "missing")
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(&p)
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetFieldMask(&hiccup.FieldMask{Header: "X-Goog-FieldMask"})
+
+	get := func(path string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path)
+	}
+
+	hiccuptest.Do(t, handler, get("/")).JSONPath("name", "hiccup").JSONPath("created_at", "2024-01-01")
+	hiccuptest.Do(t, handler, get("/?fields=name,labels.team,tags,created_at")).
+		Header("Vary", "Accept, X-Goog-FieldMask").
+		Text(`{"name":"hiccup","labels":{"team":"api"},"tags":["go"],"created_at":"2024-01-01"}`)
+	hiccuptest.Do(t, handler, get("/?fields=owner,owner.name")).
+		Text(`{"owner":{"name":"Ada","email":"ada@example.com"}}`)
+	hiccuptest.Do(t, handler, get("/?fields=id,unknown")).Text(`{"id":1}`)
+
+	// yaml names select the fields of yaml content.
+	hiccuptest.Do(t, handler, get("/?fields=id,owner.email").Accept("application/yaml")).
+		Text("id: 1\nowner:\n    email: ada@example.com\n")
+
+	hiccuptest.Do(t, handler, get("/").Header("X-Goog-FieldMask", "id")).Text(`{"id":1}`)
+	hiccuptest.Do(t, handler, get("/?fields=name").Header("X-Goog-FieldMask", "id")).Text(`{"name":"hiccup"}`)
+
+	hiccuptest.Do(t, handler, get("/list?fields=id")).
+		Text(`{"items":[{"id":1},{"id":2}],"limit":20,"offset":0,"total":2}`)
+	hiccuptest.Do(t, handler, get("/map?fields=id,owner.name")).Text(`{"id":3,"owner":{"name":"Ada"}}`)
+	hiccuptest.Do(t, handler, get("/missing?fields=id")).JSONPath("detail", "missing")
+}
+
+func TestFieldMask_Envelope(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody([]owner{{Name: "Ada", Email: "ada@example.com"}})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetFieldMask(&hiccup.FieldMask{Param: "select"}).
+		SetEnvelope(hiccup.DataEnvelope)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/?select=email")).
+		Text(`{"data":[{"email":"ada@example.com"}]}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/?fields=email")).
+		Text(`{"data":[{"name":"Ada","email":"ada@example.com"}]}`)
+}
+
+// money marshals to a different shape than its fields.
+type money struct {
+	Cents    int64
+	Currency string
+}
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"amount": float64(m.Cents) / 100, "currency": m.Currency})
+}
+
+func (m money) MarshalYAML() (any, error) {
+	return map[string]any{"amount": fmt.Sprintf("%d.%02d", m.Cents/100, m.Cents%100), "currency": m.Currency}, nil
+}
+
+func TestFieldMask_Yaml(t *testing.T) {
+	type Base struct {
+		ID    int    `json:"id" yaml:"id"`
+		Token string `json:"-" yaml:"token"`
+	}
+	type item struct {
+		Base
+		Name string `json:"name" yaml:"name"`
+	}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(item{Base: Base{ID: 1, Token: "t"}, Name: "a"})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetFieldMask(&hiccup.FieldMask{})
+
+	get := func(path string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path)
+	}
+
+	// fields follow the tags of the negotiated encoder.
+	hiccuptest.Do(t, handler, get("/?fields=id,token,name")).Text(`{"id":1,"name":"a"}`)
+	hiccuptest.Do(t, handler, get("/?fields=base.token,name").Accept("application/yaml")).
+		Text("base:\n    token: t\nname: a\n")
+	hiccuptest.Do(t, handler, get("/?fields=id").Accept("application/yaml")).Text("{}\n")
+}
+
+func TestFieldMask_Marshalers(t *testing.T) {
+	type invoice struct {
+		ID    int       `json:"id" yaml:"id"`
+		Total money     `json:"total" yaml:"total"`
+		Due   time.Time `json:"due" yaml:"due"`
+	}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(invoice{
+			ID:    1,
+			Total: money{Cents: 1250, Currency: "EUR"},
+			Due:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetFieldMask(&hiccup.FieldMask{})
+
+	get := func(path string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", path)
+	}
+
+	// selected values keep their marshalers.
+	hiccuptest.Do(t, handler, get("/?fields=total,due")).
+		Text(`{"total":{"amount":12.5,"currency":"EUR"},"due":"2024-01-01T00:00:00Z"}`)
+	hiccuptest.Do(t, handler, get("/?fields=id,due.year")).Text(`{"id":1,"due":"2024-01-01T00:00:00Z"}`)
+
+	// fields are selected from the marshaled value of the negotiated encoder.
+	hiccuptest.Do(t, handler, get("/?fields=total.amount")).Text(`{"total":{"amount":12.5}}`)
+	hiccuptest.Do(t, handler, get("/?fields=total.amount").Accept("application/yaml")).
+		Text("total:\n    amount: \"12.50\"\n")
+}
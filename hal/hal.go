@@ -0,0 +1,178 @@
+/*
+Package hal encodes HAL documents (application/hal+json) for hiccup
+handlers.
+
+Resources are plain structs. Fields are encoded as json properties
+following their "json" struct tags, and fields with a "hal" struct tag are
+encoded as links or embedded resources:
+
+	type Order struct {
+		Total    float64    `json:"total"`
+		Self     string     `hal:"link,self"`
+		Customer *Customer  `hal:"embed,customer"`
+		Items    []LineItem `hal:"embed,items"`
+	}
+
+Link fields hold the URL of a link relation, and are omitted when empty or
+nil.
+Embedded resources are encoded as HAL resources themselves.
+
+Use [Encoder] with [hiccup.Handler] to respond with HAL documents.
+*/
+package hal
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/afloesch/hiccup"
+)
+
+// ContentType is the HAL media type.
+const ContentType = "application/hal+json"
+
+/*
+Encoder returns a [hiccup.ResponseEncoder] for HAL documents.
+*/
+func Encoder() hiccup.ResponseEncoder {
+	return hiccup.WithEncoder(ContentType, Marshal)
+}
+
+/*
+Link is a HAL link object.
+*/
+type Link struct {
+	Href string `json:"href"`
+}
+
+/*
+Marshal encodes a resource struct as a HAL document. Slices are encoded as
+an array of HAL resources, and values other than structs are encoded as
+plain json.
+*/
+func Marshal(v any) ([]byte, error) {
+	doc, err := document(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func document(v reflect.Value) (any, error) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			item, err := document(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case reflect.Struct:
+		if _, ok := v.Interface().(json.Marshaler); ok {
+			return v.Interface(), nil
+		}
+		return resource(v)
+	}
+	return v.Interface(), nil
+}
+
+func resource(v reflect.Value) (map[string]any, error) {
+	t := v.Type()
+	doc := make(map[string]any)
+	links := make(map[string]Link)
+	embedded := make(map[string]any)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		if tag, ok := sf.Tag.Lookup("hal"); ok {
+			kind, rel, _ := strings.Cut(tag, ",")
+			if rel == "" {
+				return nil, fmt.Errorf("hal: invalid tag %q on %s.%s", tag, t, sf.Name)
+			}
+			switch kind {
+			case "link":
+				for (fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface) && !fv.IsNil() {
+					fv = fv.Elem()
+				}
+				if (fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface) && fv.IsNil() {
+					continue
+				}
+				if href := fmt.Sprint(fv.Interface()); href != "" {
+					links[rel] = Link{Href: href}
+				}
+			case "embed":
+				if fv.IsZero() {
+					continue
+				}
+				res, err := document(fv)
+				if err != nil {
+					return nil, err
+				}
+				embedded[rel] = res
+			default:
+				return nil, fmt.Errorf("hal: invalid tag %q on %s.%s", tag, t, sf.Name)
+			}
+			continue
+		}
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmpty(fv) {
+			continue
+		}
+		doc[name] = fv.Interface()
+	}
+
+	if len(links) > 0 {
+		doc["_links"] = links
+	}
+	if len(embedded) > 0 {
+		doc["_embedded"] = embedded
+	}
+	return doc, nil
+}
+
+/*
+isEmpty reports whether a value is empty as defined by the "omitempty"
+option of the "json" struct tag.
+*/
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package hal_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hal"
+)
+
+type customer struct {
+	Name string `json:"name"`
+	Self string `hal:"link,self"`
+}
+
+type order struct {
+	ID       int        `json:"id"`
+	Total    float64    `json:"total"`
+	Note     string     `json:"note,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+	Placed   time.Time  `json:"placed"`
+	Secret   string     `json:"-"`
+	Self     string     `hal:"link,self"`
+	Next     string     `hal:"link,next"`
+	Customer *customer  `hal:"embed,customer"`
+	Related  []customer `hal:"embed,related"`
+	internal string
+}
+
+func ExampleEncoder() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(customer{
+			Name: "Jane",
+			Self: "/customers/1",
+		})
+	}, hal.Encoder())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/customers/1", nil))
+
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Println(w.Result().Header.Get("Content-Type"), string(body))
+	// Output: application/hal+json {"_links":{"self":{"href":"/customers/1"}},"name":"Jane"}
+}
+
+func TestMarshal(t *testing.T) {
+	o := order{
+		ID:       1,
+		Total:    9.5,
+		Tags:     []string{},
+		Placed:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Secret:   "secret",
+		Self:     "/orders/1",
+		Customer: &customer{Name: "Jane", Self: "/customers/1"},
+		Related:  []customer{{Name: "John"}},
+	}
+
+	b, err := hal.Marshal(&o)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	want := `{"_embedded":{"customer":{"_links":{"self":{"href":"/customers/1"}},"name":"Jane"},"related":[{"name":"John"}]},"_links":{"self":{"href":"/orders/1"}},"id":1,"placed":"2024-01-02T03:04:05Z","total":9.5}`
+	if string(b) != want {
+		t.Error("unexpected document", string(b))
+		t.FailNow()
+	}
+
+	b, _ = hal.Marshal([]*customer{{Name: "Jane"}, nil})
+	if string(b) != `[{"name":"Jane"},null]` {
+		t.Error("unexpected collection", string(b))
+		t.FailNow()
+	}
+
+	b, _ = hal.Marshal(map[string]int{"a": 1})
+	if string(b) != `{"a":1}` {
+		t.Error("unexpected plain json", string(b))
+		t.FailNow()
+	}
+
+	b, _ = hal.Marshal([]byte("hi"))
+	if string(b) != `"aGk="` {
+		t.Error("unexpected bytes", string(b))
+		t.FailNow()
+	}
+
+	var nilOrder *order
+	if b, _ = hal.Marshal(nilOrder); string(b) != "null" {
+		t.Error("unexpected nil document", string(b))
+		t.FailNow()
+	}
+	if b, _ = hal.Marshal(nil); string(b) != "null" {
+		t.Error("unexpected nil document", string(b))
+		t.FailNow()
+	}
+
+	type invalid struct {
+		Link string `hal:"link"`
+	}
+	if _, err := hal.Marshal(invalid{}); err == nil {
+		t.Error("expected an invalid tag error")
+		t.FailNow()
+	}
+	type unknown struct {
+		Link string `hal:"other,self"`
+	}
+	if _, err := hal.Marshal([]unknown{{}}); err == nil {
+		t.Error("expected an invalid tag error")
+		t.FailNow()
+	}
+	type nested struct {
+		Embed []unknown `hal:"embed,items"`
+	}
+	if _, err := hal.Marshal(nested{Embed: []unknown{{}}}); err == nil {
+		t.Error("expected an embedded invalid tag error")
+		t.FailNow()
+	}
+
+	type optional struct {
+		Self *string `hal:"link,self"`
+		Next any     `hal:"link,next"`
+	}
+	next := "/next"
+	if b, _ = hal.Marshal(optional{}); string(b) != `{}` {
+		t.Error("unexpected nil links", string(b))
+		t.FailNow()
+	}
+	if b, _ = hal.Marshal(optional{Self: &next, Next: &next}); string(b) != `{"_links":{"next":{"href":"/next"},"self":{"href":"/next"}}}` {
+		t.Error("unexpected pointer links", string(b))
+		t.FailNow()
+	}
+
+	if !json.Valid(b) {
+		t.Error("invalid json")
+	}
+}
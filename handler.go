@@ -1,9 +1,16 @@
 package hiccup
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 /*
@@ -23,14 +30,30 @@ The [Handler] function returns a ResponseHander.
 */
 type ResponseHandler struct {
 	handler        HandlerFunc
-	encoder        map[string]ResponseEncoder
+	encoders       []ResponseEncoder
+	types          []MediaType
 	defaultEncoder ResponseEncoder
+	decoder        *RequestDecoder
+	operations     []Operation
+	allowed        []string
+	noAutoOptions  bool
+	cors           *CORS
+	auth           *Auth
+	requestID      string
+	envelope       Envelope
+	fieldMask      *FieldMask
+	redaction      *Redaction
+	idempotency    IdempotencyStore
+	cache          *Cache
+	middleware     []Middleware
+	observer       Observer
+	logger         *slog.Logger
 }
 
 var contentTypeText = mime.TypeByExtension(".txt")
 
 /*
-Handler returns a [http.Handler] for the passed [HandlerFunc],
+Handler returns a [ResponseHandler] for the passed [HandlerFunc],
 and any [ResponseEncoder]. The first ResponseEncoder passed
 will be used as the default encoder if no match can be made
 with the "Accept" header value sent in a [http.Request], or if
@@ -41,21 +64,49 @@ plain text.
 
 See [ResponseHandler.ServeHTTP] for more info.
 */
-func Handler(h HandlerFunc, w ...ResponseEncoder) http.Handler {
+func Handler(h HandlerFunc, w ...ResponseEncoder) *ResponseHandler {
 	rh := new(ResponseHandler)
 	rh.handler = h
+	rh.encoders = w
 
 	if len(w) > 0 {
 		rh.defaultEncoder = w[0]
 	}
 
-	rh.encoder = make(map[string]ResponseEncoder)
 	for _, e := range w {
-		rh.encoder[e.ContentType()] = e
+		rh.types = append(rh.types, mediaTypeOf(e.ContentType()))
 	}
 	return rh
 }
 
+/*
+Encoders returns the [ResponseEncoder] set of the handler, in the order
+they were passed to [Handler].
+*/
+func (h *ResponseHandler) Encoders() []ResponseEncoder {
+	return append([]ResponseEncoder{}, h.encoders...)
+}
+
+/*
+SetDecoder sets the [RequestDecoder] used by the handler to decode request
+body content. The decoder content types are included in the [OpenAPI]
+document of the handler.
+*/
+func (h *ResponseHandler) SetDecoder(d *RequestDecoder) *ResponseHandler {
+	h.decoder = d
+	return h
+}
+
+/*
+Describe annotates the handler with [Operation] metadata for inclusion in
+an [OpenAPI] document. A handler which serves more than one method or path
+can describe each of them.
+*/
+func (h *ResponseHandler) Describe(op ...Operation) *ResponseHandler {
+	h.operations = append(h.operations, op...)
+	return h
+}
+
 /*
 ServeHTTP implements the [http.Handler] interface for handling http
 requests.
@@ -65,58 +116,506 @@ Encoders, and the "Accept" header value sent by a client in a http
 request. If no matching encoder for the requested content type is
 found then plain text is sent.
 
+Text content types, like "text/plain" or "text/csv", are encoded with the
+charset negotiated from the "Accept-Charset" header, or from a "charset"
+parameter of the matched "Accept" media range. Text which cannot be encoded
+with the charset is sent as UTF-8, and other content types, like json, are
+always sent as UTF-8. See [RegisterCharset].
+
 If a configured encoder in the [ResponseHandler] cannot successfully
 marshal response body content the error encountered will be sent
 as plain text with a 500 status code.
 
+Response bodies which are an [fs.File] or [io.ReadSeeker] bypass the encoders
+and are sent as is, with support for "Range" and "If-Range" requests if the
+status code is 200. Partial content, multipart/byteranges, and unsatisfiable
+range responses are sent like with [http.ServeContent], and files are closed
+once sent. Raw bodies set with [Response.SetRaw] or [Response.SetFile] are
+sent as is as well.
+
+HEAD requests run the [HandlerFunc] like GET requests, and are sent the same
+headers, including the "Content-Length" of the encoded body, without the
+body. If the [Response] sets a "Content-Length" header the body is not
+encoded at all.
+
+OPTIONS requests to handlers with known methods are answered with a 204
+status code, an "Allow" header, and "Accept-Post" and "Accept-Patch" headers
+listing the content types of the [RequestDecoder], without running the
+HandlerFunc. The methods are those of a [Resource], or are read from the
+operations passed to [ResponseHandler.Describe]. OPTIONS requests to other
+handlers run the HandlerFunc. See [ResponseHandler.SetAutoOptions].
+
+If a [CORS] policy is set with [ResponseHandler.SetCORS], preflight requests
+are answered without running the HandlerFunc as well.
+
+Responses list the request headers the content negotiation depends on in a
+"Vary" header, merged with any "Vary" value set by the [Response]:
+"Accept" if the handler has encoders, and "Accept-Charset" for text content
+types.
+
 All 3XX responses will send a client redirect request back with the configured
 [Response.RedirectURI], without modifying the response body content encoded
 by [http.Redirect], and without modifying the "Content-Type" header.
 */
 func (h *ResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	res := h.handler(r)
-	for k, v := range res.Headers {
-		w.Header().Set(k, v)
+	var rlog *requestLog
+	if h.logger != nil {
+		rlog = new(requestLog)
+		lw := &logWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() { h.log(r, lw, rlog, start) }()
+		r = r.WithContext(withRequestLog(r.Context(), rlog))
+		w = lw
+	}
+	if h.requestID != "" {
+		r = h.withRequestID(r)
+		w.Header().Set(h.requestID, RequestID(r))
+	}
+	ctx := r.Context()
+	if res := h.automatic(r); res != nil {
+		copyHeader(w.Header(), responseHeader(res))
+		w.WriteHeader(res.StatusCode)
+		return
+	}
+	if h.observer != nil {
+		ctx = h.observer.HandlerStart(withObserver(ctx, h.observer), r)
+		r = r.WithContext(ctx)
+	}
+
+	n := h.negotiate(r)
+	ctx = withNegotiated(ctx, n.mediaType)
+	r = r.WithContext(ctx)
+	logEncoder(ctx, encoderContentType(n.enc))
+	if h.observer != nil {
+		h.observer.Negotiated(ctx, NegotiationEvent{
+			Accept:      r.Header.Get("Accept"),
+			ContentType: n.contentType,
+			Default:     !n.matched,
+		})
+	}
+	if h.auth != nil {
+		var res *Response
+		r = r.WithContext(withPrincipalSlot(ctx))
+		if r, res = h.auth.authenticate(r); res != nil {
+			if h.observer != nil {
+				h.observer.HandlerEnd(ctx, res)
+			}
+			h.write(w, r, res, n)
+			return
+		}
 	}
-	for _, v := range res.Cookie {
-		http.SetCookie(w, &v)
+
+	if key := r.Header.Get(idempotencyHeader); key != "" && h.idempotency != nil && isUnsafe(r.Method) {
+		h.serveIdempotent(w, r, n, key)
+		return
 	}
+	if h.cache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		h.serveCached(w, r, n)
+		return
+	}
+	h.respond(w, r, n)
+}
 
-	if res.StatusCode >= 300 && res.StatusCode < 400 {
+/*
+respond runs the handler and writes its response.
+*/
+func (h *ResponseHandler) respond(w http.ResponseWriter, r *http.Request, n negotiation) {
+	res := h.invoke(r)
+	if h.observer != nil {
+		h.observer.HandlerEnd(r.Context(), res)
+	}
+	h.write(w, r, res, n)
+}
+
+/*
+write sends a [Response] with the negotiated encoder.
+*/
+func (h *ResponseHandler) write(w http.ResponseWriter, r *http.Request, res *Response, n negotiation) {
+	ctx := r.Context()
+	if b, ok := res.Body.(storedBody); ok {
+		h.replay(w, r, res, b)
+		return
+	}
+	res = h.wrap(r, h.mask(r, h.redact(r, withRequestIDBody(r, res))))
+	copyHeader(w.Header(), responseHeader(res))
+	if h.cors != nil {
+		h.cors.apply(w.Header(), r)
+	}
+	addVary(w.Header(), n.vary...)
+	if h.fieldMask != nil && h.fieldMask.Header != "" {
+		addVary(w.Header(), h.fieldMask.Header)
+	}
+
+	if isRedirect(res) {
 		http.Redirect(w, r, res.RedirectURI, res.StatusCode)
 		return
 	}
+	if b, ok := res.Body.(*RawBody); ok {
+		logEncoder(ctx, "")
+		if err := writeRaw(w, r, res, b); err != nil {
+			logError(ctx, fmt.Errorf("sending raw body: %w", err))
+			if errors.Is(err, fs.ErrNotExist) {
+				writeTextBody(w, &Response{StatusCode: http.StatusNotFound, Body: http.StatusText(http.StatusNotFound)})
+			} else {
+				writeTextBody(w, &Response{StatusCode: http.StatusInternalServerError, Body: errorText(r, err.Error())})
+			}
+		}
+		return
+	}
+	if c, ok, err := contentBody(res.Body); ok {
+		logEncoder(ctx, "")
+		if err != nil {
+			logError(ctx, fmt.Errorf("reading file body: %w", err))
+			writeTextBody(w, &Response{StatusCode: http.StatusInternalServerError, Body: errorText(r, err.Error())})
+			return
+		}
+		writeContent(w, r, res, c)
+		return
+	}
+	h.writeBody(w, r, res, n)
+}
+
+/*
+Invoke runs the middleware chain and [HandlerFunc] of the handler for the
+passed request without writing a response, and returns the final [Response]
+along with the headers ServeHTTP would write for it.
+
+The returned body is redacted and field masked as ServeHTTP sends it, but
+not wrapped in an [Envelope]. The returned headers include cookies, the
+"Location" of redirects, and the "Content-Type" of the negotiated encoder. Raw bodies only set a
+"Content-Type" if it is known without reading them, and file and
+[io.ReadSeeker] bodies do not set one. It is intended for unit tests which
+assert on typed response body values instead of encoded content.
+*/
+func (h *ResponseHandler) Invoke(r *http.Request) (*Response, http.Header) {
+	if h.requestID != "" {
+		r = h.withRequestID(r)
+	}
+	res, header := h.invokeHeader(r)
+	if h.requestID != "" {
+		header.Set(h.requestID, RequestID(r))
+	}
+	return res, header
+}
+
+/*
+invokeHeader runs the handler for Invoke, and returns the response headers.
+*/
+func (h *ResponseHandler) invokeHeader(r *http.Request) (*Response, http.Header) {
+	if res := h.automatic(r); res != nil {
+		return res, responseHeader(res)
+	}
+	n := h.negotiate(r)
+	r = r.WithContext(withNegotiated(r.Context(), n.mediaType))
+	var res *Response
+	if h.auth != nil {
+		r = r.WithContext(withPrincipalSlot(r.Context()))
+		r, res = h.auth.authenticate(r)
+	}
+	if res == nil {
+		res = h.invoke(r)
+	}
+	res = h.mask(r, h.redact(r, withRequestIDBody(r, res)))
+	header := responseHeader(res)
+	if h.cors != nil {
+		h.cors.apply(header, r)
+	}
+	addVary(header, n.vary...)
+	if h.fieldMask != nil && h.fieldMask.Header != "" {
+		addVary(header, h.fieldMask.Header)
+	}
 
-	accept, _, _ := mime.ParseMediaType(r.Header.Get("Accept"))
-	if encFunc := h.encoder[accept]; encFunc != nil {
-		writeEncodedBody(w, res, encFunc)
-	} else if encFunc := h.defaultEncoder; encFunc != nil {
-		writeEncodedBody(w, res, encFunc)
+	if isRedirect(res) {
+		header.Set("Location", res.RedirectURI)
+	} else if b, ok := res.Body.(*RawBody); ok {
+		if ct := b.contentType(); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+	} else if isContent(res.Body) {
+		if res.StatusCode == http.StatusOK {
+			header.Set("Accept-Ranges", "bytes")
+		}
 	} else {
-		writeTextBody(w, res)
+		header.Set("Content-Type", n.contentType)
+	}
+	return res, header
+}
+
+/*
+automatic returns the response to CORS preflight and OPTIONS requests
+answered by the handler itself, or nil for requests served by the
+[HandlerFunc].
+*/
+func (h *ResponseHandler) automatic(r *http.Request) *Response {
+	switch {
+	case h.cors != nil && isPreflight(r):
+		return h.preflight(r)
+	case r.Method == http.MethodOptions && h.autoOptions():
+		res := h.options()
+		if h.cors != nil {
+			header := responseHeader(res)
+			h.cors.apply(header, r)
+			for k := range header {
+				res.SetHeader(k, header.Get(k))
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func (h *ResponseHandler) invoke(r *http.Request) *Response {
+	return h.invokeWith(r, h.handler)
+}
+
+/*
+invokeWith runs the middleware chain of the handler with the passed
+[HandlerFunc] at its end. Requests are authenticated before.
+*/
+func (h *ResponseHandler) invokeWith(r *http.Request, next HandlerFunc) *Response {
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		next = h.middleware[i](next)
 	}
+	return next(r)
 }
 
-func writeEncodedBody(w http.ResponseWriter, r *Response, enc ResponseEncoder) {
-	b, err := enc.Marshal(r.Body)
+/*
+negotiation is the result of response content negotiation.
+*/
+type negotiation struct {
+	// Selected encoder, or nil to send plain text.
+	enc ResponseEncoder
+	// Negotiated media type exposed to handlers.
+	mediaType MediaType
+	// "Content-Type" header value to send.
+	contentType string
+	// Charset to encode text with, or nil to send UTF-8.
+	charset Charset
+	// A media range sent in the request was matched.
+	matched bool
+	// Request headers the negotiation depends on, sent in the "Vary" header.
+	vary []string
+}
+
+/*
+negotiate selects the encoder for the "Accept" header value sent in the
+request. Media ranges are tried in order of preference, and if none can be
+matched the default encoder is selected.
+*/
+func (h *ResponseHandler) negotiate(r *http.Request) negotiation {
+	ranges, err := parseAccept(r.Header.Get("Accept"))
 	if err != nil {
+		logError(r.Context(), fmt.Errorf("parsing accept header: %w", err))
+	}
+	var vary []string
+	if len(h.encoders) > 0 {
+		vary = append(vary, "Accept")
+	}
+
+	for _, ar := range ranges {
+		i := -1
+		switch {
+		case ar.Type == "*" && len(h.encoders) > 0:
+			i = 0
+		case ar.Subtype == "*":
+			for j, t := range h.types {
+				if t.Type == ar.Type {
+					i = j
+					break
+				}
+			}
+		default:
+			i = matchMediaType(h.types, ar.MediaType)
+		}
+		if i < 0 {
+			continue
+		}
+
+		n := negotiation{
+			enc:         h.encoders[i],
+			mediaType:   h.types[i],
+			contentType: h.encoders[i].ContentType(),
+			matched:     true,
+			vary:        vary,
+		}
+		if ar.Type != "*" && ar.Subtype != "*" {
+			n.mediaType = ar.MediaType
+			if h.types[i].Essence() != ar.Essence() || len(ar.Params) > len(h.types[i].Params) {
+				// echo the vendor type or parameters sent by the client.
+				n.contentType = ar.String()
+			}
+		}
+		return n.withCharset(r, ar.Params["charset"])
+	}
+
+	if h.defaultEncoder == nil {
+		n := negotiation{mediaType: mediaTypeOf(contentTypeText), contentType: contentTypeText, vary: vary}
+		return n.withCharset(r, "")
+	}
+	n := negotiation{
+		enc:         h.defaultEncoder,
+		mediaType:   h.types[0],
+		contentType: h.defaultEncoder.ContentType(),
+		vary:        vary,
+	}
+	return n.withCharset(r, "")
+}
+
+/*
+withCharset negotiates the charset of text content types, preferring the
+charset sent with the matched media range if any.
+*/
+func (n negotiation) withCharset(r *http.Request, charset string) negotiation {
+	if !isText(mediaTypeOf(n.contentType)) {
+		if charset != "" {
+			// the content is not transcoded, so the charset of the media
+			// range is not echoed.
+			m := mediaTypeOf(n.contentType)
+			delete(m.Params, "charset")
+			if c := mediaTypeOf(encoderContentType(n.enc)).Params["charset"]; c != "" {
+				m.Params["charset"] = c
+			}
+			n.contentType = m.String()
+		}
+		return n
+	}
+	n.vary = append(n.vary[:len(n.vary):len(n.vary)], "Accept-Charset")
+	if c := negotiateCharset(r.Header.Get("Accept-Charset"), charset); c != nil {
+		n.charset = c
+		n.contentType = withCharset(n.contentType, c)
+	}
+	return n
+}
+
+/*
+writeBody encodes the response body with the negotiated encoder, or as plain
+text if there is none, and writes the response.
+*/
+func (h *ResponseHandler) writeBody(w http.ResponseWriter, r *http.Request, res *Response, n negotiation) {
+	enc, contentType := n.enc, n.contentType
+	if r.Method == http.MethodHead && w.Header().Get("Content-Length") != "" {
+		// the handler set the length, so the body need not be encoded.
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(res.StatusCode)
+		return
+	}
+
+	ctx := r.Context()
+	if h.observer != nil {
+		ctx = h.observer.EncodeStart(ctx)
+	}
+
+	b, err := marshalBody(r, res, enc)
+	if err == nil && n.charset != nil {
+		if cb, cerr := n.charset.Encode(b); cerr == nil {
+			b = cb
+		} else {
+			// send the text as UTF-8 instead of losing characters.
+			contentType = withCharset(contentType, utf8Charset{})
+		}
+	}
+	if h.observer != nil {
+		h.observer.EncodeEnd(ctx, EncodeEvent{
+			ContentType: contentType,
+			Bytes:       len(b),
+			Err:         err,
+		})
+	}
+	if err != nil {
+		logError(ctx, fmt.Errorf("encoding %s body, sent as plain text: %w", contentType, err))
 		writeTextBody(w, &Response{
 			StatusCode: http.StatusInternalServerError,
-			Body:       err.Error(),
+			Body:       errorText(r, err.Error()),
 		})
 		return
 	}
 
-	/*for k, v := range r.Headers {
-		w.Header().Set(k, v)
-	}*/
-	w.Header().Set("Content-Type", enc.ContentType())
-	w.WriteHeader(r.StatusCode)
-
-	if len(b) > 0 {
+	w.Header().Set("Content-Type", contentType)
+	if bodyAllowed(res.StatusCode) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	}
+	w.WriteHeader(res.StatusCode)
+	if r.Method != http.MethodHead {
 		w.Write(b)
-	} else {
-		w.Write([]byte(""))
+	}
+}
+
+func marshalBody(r *http.Request, res *Response, enc ResponseEncoder) ([]byte, error) {
+	if m, ok := enc.(RequestMarshaler); ok {
+		r = r.WithContext(context.WithValue(r.Context(), responseStatusKey{}, res.StatusCode))
+		return m.MarshalRequest(r, res.Body)
+	}
+	if enc != nil {
+		return enc.Marshal(res.Body)
+	}
+	if res.Body == nil {
+		return nil, nil
+	}
+	return []byte(fmt.Sprint(res.Body)), nil
+}
+
+func encoderContentType(enc ResponseEncoder) string {
+	if enc == nil {
+		return contentTypeText
+	}
+	return enc.ContentType()
+}
+
+func isRedirect(res *Response) bool {
+	return res.StatusCode >= 300 && res.StatusCode < 400
+}
+
+/*
+responseHeader returns the headers and cookies configured in a [Response].
+Invalid cookies are dropped, like with [http.SetCookie].
+*/
+func responseHeader(res *Response) http.Header {
+	header := make(http.Header)
+	for k, v := range res.Headers {
+		header.Set(k, v)
+	}
+	for k, v := range res.HeaderValues {
+		for _, s := range v {
+			header.Add(k, s)
+		}
+	}
+	for _, c := range res.Cookie {
+		if v := c.String(); v != "" {
+			header.Add("Set-Cookie", v)
+		}
+	}
+	return header
+}
+
+/*
+listHeaders are the response headers which hold a list of values, and are
+added to the values set by outer middleware instead of replacing them.
+*/
+var listHeaders = map[string]bool{
+	"Set-Cookie":       true,
+	"Link":             true,
+	"Www-Authenticate": true,
+	"Via":              true,
+	"Warning":          true,
+}
+
+/*
+copyHeader copies response headers to the headers of a
+[http.ResponseWriter]. List headers and "Vary" values are added to any
+values already set, and other headers replace them.
+*/
+func copyHeader(dst http.Header, src http.Header) {
+	for k, v := range src {
+		switch {
+		case k == "Vary":
+			for _, s := range v {
+				addVary(dst, strings.Split(s, ",")...)
+			}
+		case listHeaders[k]:
+			dst[k] = append(dst[k], v...)
+		default:
+			dst[k] = append([]string{}, v...)
+		}
 	}
 }
 
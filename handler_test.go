@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
 	"go.yaml.in/yaml/v3"
 )
 
@@ -129,6 +130,10 @@ func testRequest(method string, url string, body io.Reader) (*httptest.ResponseR
 	return w, req
 }
 
+func httptestRequest(method string, url string) *http.Request {
+	return httptest.NewRequest(method, url, nil)
+}
+
 func testFailMarshal(v any) ([]byte, error) {
 	return nil, errors.New("marshal failed")
 }
@@ -246,3 +251,164 @@ func TestHandler(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestHandler_Hiccuptest(t *testing.T) {
+	myHandler := func(r *http.Request) *hiccup.Response {
+		return hiccup.
+			Respond(http.StatusOK).
+			SetHeader("Cookie", "key=value;").
+			SetHeader("x-test", "value").
+			SetCookies([]http.Cookie{{
+				Name:  "test_cookie",
+				Value: "cookie_value",
+				Path:  "/",
+			}}).
+			SetBody(map[string]string{
+				"Message": "Hello World!",
+			})
+	}
+
+	// define the supported response formats.
+	// this example demonstrates json, yaml, and plain text.
+	en := []hiccup.ResponseEncoder{
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+		hiccup.WithEncoder("text/plain", hiccup.MarshalText),
+		hiccup.WithEncoder("test/failed", testFailMarshal),
+	}
+
+	handler := hiccup.Handler(myHandler, en...)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("application/yaml")).
+		Text("Message: Hello World!\n")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("application/json")).
+		Text(`{"Message":"Hello World!"}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Text(`{"Message":"Hello World!"}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("text/plain")).
+		Text(`map[Message:Hello World!]`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("test/failed")).
+		Status(http.StatusInternalServerError).
+		Text(`marshal failed`)
+
+	hiccuptest.Do(t, hiccup.Handler(myHandler), hiccuptest.NewRequest("GET", "/")).
+		Header("Cookie", "key=value;").
+		Header("Set-Cookie", "test_cookie=cookie_value; Path=/").
+		Text(`map[Message:Hello World!]`)
+}
+
+func ExampleResponseHandler_Invoke() {
+	type Message struct {
+		Text string
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(Message{Text: "Hello World!"})
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	// assert on the typed body without decoding the response content.
+	res, header := handler.Invoke(httptest.NewRequest("GET", "/", nil))
+	fmt.Println(res.Body.(Message).Text, header.Get("Content-Type"))
+	// Output: Hello World! application/json
+}
+
+func TestResponseHandler_Invoke(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Path == "/old" {
+			return hiccup.Respond(http.StatusFound).SetRedirectURI("/new")
+		}
+		return hiccup.Respond(http.StatusOK).
+			SetHeader("x-test", "value").
+			SetCookies([]http.Cookie{
+				{Name: "a", Value: "1"},
+				{Name: "b", Value: "2"},
+				{Name: "", Value: "invalid"},
+			})
+	})
+
+	res, header := handler.Invoke(httptestRequest("GET", "/old"))
+	if res.StatusCode != http.StatusFound || header.Get("Location") != "/new" {
+		t.Error("unexpected redirect", res.StatusCode, header)
+		t.FailNow()
+	}
+
+	res, header = handler.Invoke(httptestRequest("GET", "/"))
+	if res.StatusCode != http.StatusOK || header.Get("x-test") != "value" {
+		t.Error("unexpected response", res.StatusCode, header)
+		t.FailNow()
+	}
+	if len(header.Values("Set-Cookie")) != 2 {
+		t.Error("unexpected cookies", header.Values("Set-Cookie"))
+		t.FailNow()
+	}
+	if header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Error("unexpected content type", header.Get("Content-Type"))
+		t.FailNow()
+	}
+
+	w, req := testRequest("GET", "/", nil)
+	handler.ServeHTTP(w, req)
+	if len(w.Header().Values("Set-Cookie")) != 2 {
+		t.Error("unexpected written cookies", w.Header().Values("Set-Cookie"))
+		t.FailNow()
+	}
+}
+
+// queryEncoder encodes the body with a query parameter of the request.
+type queryEncoder struct{}
+
+func (queryEncoder) ContentType() string { return "text/query" }
+
+func (queryEncoder) Marshal(v any) ([]byte, error) { return hiccup.MarshalText(v) }
+
+func (queryEncoder) MarshalRequest(r *http.Request, v any) ([]byte, error) {
+	return []byte(fmt.Sprint(v, " ", r.URL.Query().Get("q"))), nil
+}
+
+func TestHandler_RequestMarshaler(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("Hello")
+	}, queryEncoder{})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/?q=World")).
+		ContentType("text/query").
+		Text("Hello World")
+}
+
+func TestHandler_OuterHeaders(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).
+			SetHeader("x-test", "inner").
+			AddHeader("Link", `</next>; rel="next"`).
+			SetCookies([]http.Cookie{{Name: "inner", Value: "1"}}).
+			SetBody("Hello")
+	})
+
+	// outer net/http middleware setting headers before the handler.
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "outer", Value: "1"})
+		w.Header().Set("Link", `</first>; rel="first"`)
+		w.Header().Set("Vary", "Origin")
+		w.Header().Set("x-test", "outer")
+		handler.ServeHTTP(w, r)
+	})
+
+	w, req := testRequest("GET", "/", nil)
+	outer.ServeHTTP(w, req)
+	if cookies := w.Header().Values("Set-Cookie"); len(cookies) != 2 || cookies[0] != "outer=1" || cookies[1] != "inner=1" {
+		t.Error("unexpected cookies", cookies)
+		t.FailNow()
+	}
+	if len(w.Header().Values("Link")) != 2 {
+		t.Error("unexpected links", w.Header().Values("Link"))
+		t.FailNow()
+	}
+	if w.Header().Get("Vary") != "Origin, Accept-Charset" {
+		t.Error("unexpected vary", w.Header().Values("Vary"))
+		t.FailNow()
+	}
+	if w.Header().Get("x-test") != "inner" {
+		t.Error("header not replaced", w.Header().Values("x-test"))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,372 @@
+/*
+Package hiccuptest provides utilities for testing http handlers built with
+hiccup, without the httptest and io boilerplate.
+
+Requests are built fluently with [NewRequest], sent with [Do], and the
+returned [Result] asserts on the recorded response:
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/articles").
+		Accept("application/json").
+		Body(jsonCodec, article)).
+		Status(http.StatusCreated).
+		ContentType("application/json").
+		JSONPath("author.name", "Jane")
+*/
+package hiccuptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+)
+
+/*
+Update golden files instead of comparing against them. It is enabled by
+setting the HICCUPTEST_UPDATE environment variable to any value.
+*/
+var Update = os.Getenv("HICCUPTEST_UPDATE") != ""
+
+/*
+Codec both encodes and decodes body content of a single content type. It
+conforms to both the [hiccup.ResponseEncoder] and [hiccup.BodyDecoder]
+interfaces.
+*/
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type codec struct {
+	contentType string
+	marshaler   hiccup.Marshaler
+	unmarshaler hiccup.Unmarshaler
+}
+
+/*
+WithCodec is a helper function that returns a [Codec] for the passed
+content type, [hiccup.Marshaler] and [hiccup.Unmarshaler].
+*/
+func WithCodec(contentType string, m hiccup.Marshaler, u hiccup.Unmarshaler) Codec {
+	return &codec{
+		contentType: contentType,
+		marshaler:   m,
+		unmarshaler: u,
+	}
+}
+
+func (c *codec) ContentType() string {
+	return c.contentType
+}
+
+func (c *codec) Marshal(v any) ([]byte, error) {
+	return c.marshaler(v)
+}
+
+func (c *codec) Unmarshal(data []byte, v any) error {
+	return c.unmarshaler(data, v)
+}
+
+/*
+Request is a fluent builder for test requests.
+
+See [NewRequest].
+*/
+type Request struct {
+	method string
+	target string
+	header http.Header
+	body   []byte
+	remote string
+	err    error
+}
+
+/*
+NewRequest returns a [Request] builder for the passed method and target
+path.
+*/
+func NewRequest(method string, target string) *Request {
+	return &Request{
+		method: method,
+		target: target,
+		header: make(http.Header),
+	}
+}
+
+/*
+Header sets a request header value. Any existing value will be overwritten.
+*/
+func (r *Request) Header(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+/*
+Accept sets the "Accept" header value of the request.
+*/
+func (r *Request) Accept(contentType string) *Request {
+	return r.Header("Accept", contentType)
+}
+
+/*
+Body encodes the passed value with the [hiccup.ResponseEncoder] of a codec
+as the request body, and sets the "Content-Type" header to the codec content
+type. Encoding errors are reported by [Do].
+*/
+func (r *Request) Body(enc hiccup.ResponseEncoder, v any) *Request {
+	r.body, r.err = enc.Marshal(v)
+	return r.Header("Content-Type", enc.ContentType())
+}
+
+/*
+RawBody sets the request body and "Content-Type" header as is.
+*/
+func (r *Request) RawBody(contentType string, body []byte) *Request {
+	r.body = body
+	return r.Header("Content-Type", contentType)
+}
+
+/*
+RemoteAddr sets the network address of the client sending the request.
+*/
+func (r *Request) RemoteAddr(addr string) *Request {
+	r.remote = addr
+	return r
+}
+
+/*
+Build returns the [http.Request] for the builder. A new request is returned
+on every call, so a builder can be sent more than once.
+*/
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, r.target, body)
+	if r.remote != "" {
+		req.RemoteAddr = r.remote
+	}
+	for k, v := range r.header {
+		req.Header[k] = append([]string{}, v...)
+	}
+	return req, nil
+}
+
+/*
+Result holds a recorded response, and asserts on it. Failed assertions are
+reported with [testing.TB.Errorf], so every assertion of a chain runs.
+*/
+type Result struct {
+	t testing.TB
+	// Recorded response.
+	Response *http.Response
+	// Raw response body content.
+	Body []byte
+}
+
+/*
+Do sends the built request to the handler, and returns the [Result] of
+the recorded response. Request build errors fail the test immediately.
+*/
+func Do(t testing.TB, h http.Handler, r *Request) *Result {
+	t.Helper()
+	req, err := r.Build()
+	if err != nil {
+		t.Fatalf("hiccuptest: building request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	body, _ := io.ReadAll(res.Body)
+	return &Result{t: t, Response: res, Body: body}
+}
+
+/*
+Status asserts the response status code.
+*/
+func (r *Result) Status(want int) *Result {
+	r.t.Helper()
+	if r.Response.StatusCode != want {
+		r.t.Errorf("hiccuptest: status code is %d, want %d", r.Response.StatusCode, want)
+	}
+	return r
+}
+
+/*
+Header asserts a response header value.
+*/
+func (r *Result) Header(key string, want string) *Result {
+	r.t.Helper()
+	if got := r.Response.Header.Get(key); got != want {
+		r.t.Errorf("hiccuptest: header %q is %q, want %q", key, got, want)
+	}
+	return r
+}
+
+/*
+ContentType asserts the media type of the "Content-Type" response header.
+Parameters are only compared if the wanted value has any.
+*/
+func (r *Result) ContentType(want string) *Result {
+	r.t.Helper()
+	got := r.Response.Header.Get("Content-Type")
+	gotType, gotParams, _ := mime.ParseMediaType(got)
+	wantType, wantParams, _ := mime.ParseMediaType(want)
+	if gotType != wantType || (len(wantParams) > 0 && !reflect.DeepEqual(gotParams, wantParams)) {
+		r.t.Errorf("hiccuptest: content type is %q, want %q", got, want)
+	}
+	return r
+}
+
+/*
+Text asserts the raw response body content.
+*/
+func (r *Result) Text(want string) *Result {
+	r.t.Helper()
+	if string(r.Body) != want {
+		r.t.Errorf("hiccuptest: body is %q, want %q", r.Body, want)
+	}
+	return r
+}
+
+/*
+Decodes asserts the response body decodes to a value deeply equal to the
+wanted value. The body is decoded with the passed [hiccup.BodyDecoder] into
+a new value of the wanted value type.
+*/
+func (r *Result) Decodes(dec hiccup.BodyDecoder, want any) *Result {
+	r.t.Helper()
+	got := reflect.New(reflect.TypeOf(want))
+	if err := dec.Unmarshal(r.Body, got.Interface()); err != nil {
+		r.t.Errorf("hiccuptest: decoding body: %v", err)
+		return r
+	}
+	if !reflect.DeepEqual(got.Elem().Interface(), want) {
+		r.t.Errorf("hiccuptest: body is %+v, want %+v", got.Elem().Interface(), want)
+	}
+	return r
+}
+
+/*
+JSONPath asserts the value at a path of a json response body. Paths are
+dot separated object keys and array indexes, like "items.0.name", where
+"" selects the whole body. The wanted value is compared after a json round
+trip, so any value with the same json encoding matches.
+*/
+func (r *Result) JSONPath(path string, want any) *Result {
+	r.t.Helper()
+	var got any
+	if err := json.Unmarshal(r.Body, &got); err != nil {
+		r.t.Errorf("hiccuptest: decoding json body: %v", err)
+		return r
+	}
+
+	got, err := lookup(got, path)
+	if err != nil {
+		r.t.Errorf("hiccuptest: json path %q: %v", path, err)
+		return r
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		r.t.Errorf("hiccuptest: encoding wanted value: %v", err)
+		return r
+	}
+	var wantv any
+	json.Unmarshal(b, &wantv)
+
+	if !reflect.DeepEqual(got, wantv) {
+		r.t.Errorf("hiccuptest: json path %q is %v, want %v", path, got, wantv)
+	}
+	return r
+}
+
+func lookup(v any, path string) (any, error) {
+	if path == "" {
+		return v, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			val, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", key)
+			}
+			v = val
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("index %q out of range", key)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("cannot select %q from %T", key, v)
+		}
+	}
+	return v, nil
+}
+
+/*
+Golden asserts the raw response body matches the content of a golden file.
+If [Update] is enabled the file is written with the body content instead.
+*/
+func (r *Result) Golden(path string) *Result {
+	r.t.Helper()
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Errorf("hiccuptest: updating golden file: %v", err)
+			return r
+		}
+		if err := os.WriteFile(path, r.Body, 0o644); err != nil {
+			r.t.Errorf("hiccuptest: updating golden file: %v", err)
+		}
+		return r
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Errorf("hiccuptest: reading golden file: %v", err)
+		return r
+	}
+	if !bytes.Equal(r.Body, want) {
+		r.t.Errorf("hiccuptest: body does not match golden file %s\ngot:\n%s\nwant:\n%s", path, r.Body, want)
+	}
+	return r
+}
+
+/*
+EachEncoder sends the request to the handler once for every
+[hiccup.ResponseEncoder] registered with it, in a subtest named after the
+encoder content type. The "Accept" header of every request is set to the
+encoder content type, and the result is passed to fn.
+*/
+func EachEncoder(t *testing.T, h *hiccup.ResponseHandler, r *Request, fn func(t *testing.T, enc hiccup.ResponseEncoder, res *Result)) {
+	t.Helper()
+	for _, enc := range h.Encoders() {
+		t.Run(enc.ContentType(), func(t *testing.T) {
+			req := *r
+			req.header = r.header.Clone()
+			req.Accept(enc.ContentType())
+			fn(t, enc, Do(t, h, &req))
+		})
+	}
+}
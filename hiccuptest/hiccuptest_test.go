@@ -0,0 +1,183 @@
+package hiccuptest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+type message struct {
+	Text  string   `json:"text" yaml:"text"`
+	Items []string `json:"items,omitempty" yaml:"items,omitempty"`
+}
+
+var (
+	jsonCodec = hiccuptest.WithCodec("application/json", json.Marshal, json.Unmarshal)
+	yamlCodec = hiccuptest.WithCodec("application/yaml", yaml.Marshal, yaml.Unmarshal)
+)
+
+func echoHandler() *hiccup.ResponseHandler {
+	dec := hiccup.Decoder(jsonCodec, yamlCodec)
+	return hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		var m message
+		if _, err := dec.DecodeBody(r, &m); err != nil {
+			return hiccup.Respond(http.StatusBadRequest).SetBody(err.Error())
+		}
+		return hiccup.Respond(http.StatusOK).
+			SetHeader("x-method", r.Method).
+			SetBody(m)
+	}, jsonCodec, yamlCodec)
+}
+
+// failTB records failed assertions instead of failing the test.
+type failTB struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (f *failTB) Helper() {}
+
+func (f *failTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *failTB) Fatalf(format string, args ...any) {
+	f.Errorf(format, args...)
+	f.fatal = true
+	runtime.Goexit()
+}
+
+func ExampleDo() {
+	t := new(testing.T) // use the *testing.T of a test function
+
+	hiccuptest.Do(t, echoHandler(), hiccuptest.NewRequest("POST", "/").
+		Accept("application/yaml").
+		Body(jsonCodec, message{Text: "Hello World!"})).
+		Status(http.StatusOK).
+		ContentType("application/yaml").
+		Text("text: Hello World!\n")
+
+	fmt.Println(t.Failed())
+	// Output: false
+}
+
+func TestDo(t *testing.T) {
+	h := echoHandler()
+	req := hiccuptest.NewRequest("PUT", "/").
+		Header("x-test", "value").
+		Body(jsonCodec, message{Text: "Hello", Items: []string{"a", "b"}})
+
+	hiccuptest.Do(t, h, req).
+		Status(http.StatusOK).
+		Header("x-method", "PUT").
+		ContentType("application/json").
+		Decodes(jsonCodec, message{Text: "Hello", Items: []string{"a", "b"}}).
+		JSONPath("", map[string]any{"text": "Hello", "items": []string{"a", "b"}}).
+		JSONPath("items.1", "b").
+		Text(`{"text":"Hello","items":["a","b"]}`)
+
+	hiccuptest.Do(t, h, hiccuptest.NewRequest("POST", "/").RawBody("application/yaml", []byte("text: raw"))).
+		JSONPath("text", "raw")
+
+	f := new(failTB)
+	hiccuptest.Do(f, h, req).
+		Status(http.StatusTeapot).
+		Header("x-method", "GET").
+		ContentType("application/json; charset=utf-8").
+		Decodes(jsonCodec, message{}).
+		Decodes(yamlCodec, 1).
+		JSONPath("items.5", "b").
+		JSONPath("items.x", "b").
+		JSONPath("text.x", "b").
+		JSONPath("missing", "b").
+		JSONPath("text", "Goodbye").
+		JSONPath("text", func() {}).
+		Text("")
+	if len(f.errors) != 12 {
+		t.Error("expected failed assertions", len(f.errors), f.errors)
+		t.FailNow()
+	}
+
+	f = new(failTB)
+	hiccuptest.Do(f, h, hiccuptest.NewRequest("POST", "/").Accept("application/yaml")).
+		JSONPath("text", "")
+	if len(f.errors) != 1 {
+		t.Error("expected a json decoding failure", f.errors)
+		t.FailNow()
+	}
+
+	f = new(failTB)
+	enc := hiccup.WithEncoder("test/failed", func(v any) ([]byte, error) {
+		return nil, errors.New("marshal failed")
+	})
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		hiccuptest.Do(f, h, hiccuptest.NewRequest("POST", "/").Body(enc, "body"))
+	}()
+	<-done
+	if !f.fatal {
+		t.Error("expected a fatal request build error")
+		t.FailNow()
+	}
+}
+
+func TestResult_Golden(t *testing.T) {
+	h := echoHandler()
+	req := hiccuptest.NewRequest("POST", "/").Body(jsonCodec, message{Text: "Hello"})
+	hiccuptest.Do(t, h, req).Golden("testdata/message.golden")
+
+	f := new(failTB)
+	hiccuptest.Do(f, h, req).Golden("testdata/missing.golden")
+	hiccuptest.Do(f, h, req.Accept("application/yaml")).Golden("testdata/message.golden")
+	if len(f.errors) != 2 {
+		t.Error("expected golden file failures", f.errors)
+		t.FailNow()
+	}
+
+	path := filepath.Join(t.TempDir(), "golden", "update.golden")
+	hiccuptest.Update = true
+	defer func() { hiccuptest.Update = false }()
+	hiccuptest.Do(t, h, req).Golden(path)
+	if b, err := os.ReadFile(path); err != nil || string(b) != "text: Hello\n" {
+		t.Error("golden file not updated", err, string(b))
+		t.FailNow()
+	}
+
+	f = new(failTB)
+	hiccuptest.Do(f, h, req).Golden(filepath.Join(path, "file.golden"))
+	if len(f.errors) != 1 {
+		t.Error("expected a golden file update failure", f.errors)
+		t.FailNow()
+	}
+}
+
+func TestEachEncoder(t *testing.T) {
+	h := echoHandler()
+	req := hiccuptest.NewRequest("POST", "/").Body(jsonCodec, message{Text: "Hello"})
+
+	var seen []string
+	hiccuptest.EachEncoder(t, h, req, func(t *testing.T, enc hiccup.ResponseEncoder, res *hiccuptest.Result) {
+		seen = append(seen, enc.ContentType())
+		res.Status(http.StatusOK).
+			ContentType(enc.ContentType()).
+			Decodes(enc.(hiccuptest.Codec), message{Text: "Hello"})
+	})
+	if len(seen) != 2 || seen[0] != "application/json" || seen[1] != "application/yaml" {
+		t.Error("unexpected encoders", seen)
+		t.FailNow()
+	}
+
+	// the builder is not modified by the runner.
+	hiccuptest.Do(t, h, req).ContentType("application/json")
+}
@@ -0,0 +1,328 @@
+package hiccup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+/*
+IdempotencyRecord is the stored outcome of a request sent with an
+"Idempotency-Key" header.
+*/
+type IdempotencyRecord struct {
+	// Fingerprint of the request method, path and body.
+	Fingerprint string
+	// The request completed. Records are stored incomplete while the request
+	// is in flight.
+	Done bool
+	// Status code of the response.
+	StatusCode int
+	// Response headers, including the "Content-Type". Cookies are not
+	// stored.
+	Header http.Header
+	// Encoded response body.
+	Body []byte
+}
+
+/*
+IdempotencyStore stores the records of idempotency keys. Implementations
+must be safe for concurrent use, and Claim must be atomic across every
+server sharing the store.
+
+See [ResponseHandler.SetIdempotency] and [NewMemoryIdempotencyStore].
+*/
+type IdempotencyStore interface {
+	// Claim stores an incomplete record for an unused key and returns nil,
+	// or returns the existing record of the key.
+	Claim(ctx context.Context, key string, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Save replaces the record of a claimed key with its completed record.
+	Save(ctx context.Context, key string, rec *IdempotencyRecord) error
+	// Release removes the record of a claimed key, so the key can be
+	// retried.
+	Release(ctx context.Context, key string) error
+}
+
+/*
+SetIdempotency enables "Idempotency-Key" support for POST, PUT, PATCH and
+DELETE requests, with records kept in the passed [IdempotencyStore].
+Passing nil disables it.
+
+The first request with a key runs the handler, and its encoded response is
+stored. Retries with the same key and request are sent the stored response
+without running the handler, with an "Idempotent-Replayed" header. A key
+reused for a different request is sent a 422 status code, and a retry while
+the first request is in flight is sent a 409 status code. Responses with a
+5XX status code are not stored, so the request can be retried.
+
+Keys are scoped to the "Authorization" and "Cookie" headers of the request,
+and to the [Principal] resolved by [Auth], so clients are never sent the
+stored response of another client. Requests are authenticated before
+stored responses are replayed, and stored responses, and the 409 and 422
+responses, pass through any [Middleware] like responses of the HandlerFunc.
+Stored responses are replayed with the status, headers, cookies and
+encoding of the first response.
+*/
+func (h *ResponseHandler) SetIdempotency(s IdempotencyStore) *ResponseHandler {
+	h.idempotency = s
+	return h
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+/*
+fingerprint hashes the request method, path and body. The body is restored
+so the handler can read it.
+*/
+func fingerprint(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		body = b
+	}
+
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", r.Method, r.URL.RequestURI())
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+/*
+idempotencyKey returns the stored key of an idempotency key, scoped to the
+client of the request, so a key sent by another client never matches.
+*/
+func idempotencyKey(r *http.Request, key string) string {
+	if scope := clientScope(r); scope != "" {
+		return key + " " + scope
+	}
+	return key
+}
+
+/*
+clientScope returns a hash of the credentials sent with a request and of
+its resolved [Principal], which tells clients apart, or an empty string for
+anonymous requests. Principals are told apart by their Go representation.
+*/
+func clientScope(r *http.Request) string {
+	auth, cookie, principal := r.Header.Values("Authorization"), r.Header.Values("Cookie"), Principal(r)
+	if len(auth) == 0 && len(cookie) == 0 && principal == nil {
+		return ""
+	}
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%q %q %#v", auth, cookie, principal)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func (h *ResponseHandler) serveIdempotent(w http.ResponseWriter, r *http.Request, n negotiation, key string) {
+	ctx := r.Context()
+	key = idempotencyKey(r, key)
+
+	// the key is claimed within the middleware chain, so replays and key
+	// errors pass through middleware like responses of the HandlerFunc.
+	var fp string
+	claimed, completed := false, false
+	defer func() {
+		if !claimed || completed {
+			return
+		}
+		// release the key if the handler fails or panics, so it can be
+		// retried.
+		if err := h.idempotency.Release(context.WithoutCancel(ctx), key); err != nil {
+			logError(ctx, fmt.Errorf("releasing idempotency key: %w", err))
+		}
+	}()
+
+	res := h.invokeWith(r, func(r *http.Request) *Response {
+		ctx := r.Context()
+		var err error
+		if fp, err = fingerprint(r); err != nil {
+			logError(ctx, fmt.Errorf("reading request body: %w", err))
+			return Respond(http.StatusBadRequest).SetBody("cannot read request body")
+		}
+
+		prev, err := h.idempotency.Claim(ctx, key, &IdempotencyRecord{Fingerprint: fp})
+		switch {
+		case err != nil:
+			logError(ctx, fmt.Errorf("claiming idempotency key: %w", err))
+			return Respond(http.StatusInternalServerError).SetBody("idempotency store unavailable")
+		case prev != nil && prev.Fingerprint != fp:
+			return Respond(http.StatusUnprocessableEntity).SetBody("idempotency key reused with a different request")
+		case prev != nil && !prev.Done:
+			return Respond(http.StatusConflict).SetBody("a request with this idempotency key is in progress")
+		case prev != nil:
+			res := &Response{StatusCode: prev.StatusCode, HeaderValues: prev.Header.Clone(), Body: storedBody(prev.Body)}
+			return res.SetHeader("Idempotent-Replayed", "true")
+		}
+		claimed = true
+		return h.handler(r)
+	})
+	if h.observer != nil {
+		h.observer.HandlerEnd(ctx, res)
+	}
+	if !claimed {
+		h.write(w, r, res, n)
+		return
+	}
+
+	rw := &recordWriter{ResponseWriter: w, status: http.StatusOK}
+	h.write(rw, r, res, n)
+	if rw.status >= 500 {
+		return
+	}
+	completed = true
+
+	err := h.idempotency.Save(context.WithoutCancel(ctx), key, &IdempotencyRecord{
+		Fingerprint: fp,
+		Done:        true,
+		StatusCode:  rw.status,
+		Header:      h.storedHeader(w.Header()),
+		Body:        rw.body.Bytes(),
+	})
+	if err != nil {
+		logError(ctx, fmt.Errorf("saving idempotency record: %w", err))
+	}
+}
+
+/*
+storedHeader returns a copy of response headers to store. CORS headers
+depend on the origin of each request, and the request ID on each request,
+so they are not stored.
+*/
+func (h *ResponseHandler) storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	for k := range stored {
+		if strings.HasPrefix(k, "Access-Control-") || k == h.requestID {
+			delete(stored, k)
+		}
+	}
+	return stored
+}
+
+/*
+storedBody is the encoded body of a stored response, which is sent as is.
+*/
+type storedBody []byte
+
+/*
+replay writes a stored response, with the CORS headers of the request.
+*/
+func (h *ResponseHandler) replay(w http.ResponseWriter, r *http.Request, res *Response, body storedBody) {
+	copyHeader(w.Header(), responseHeader(res))
+	if h.cors != nil {
+		h.cors.apply(w.Header(), r)
+	}
+	w.WriteHeader(res.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+/*
+recordWriter records the status code and body written to a
+[http.ResponseWriter].
+*/
+type recordWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+/*
+MemoryIdempotencyStore is an in-memory [IdempotencyStore], for single
+server deployments and tests.
+*/
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	records map[string]memoryRecord
+	swept   time.Time
+}
+
+type memoryRecord struct {
+	rec     *IdempotencyRecord
+	expires time.Time
+}
+
+/*
+NewMemoryIdempotencyStore returns a [MemoryIdempotencyStore] which keeps
+records for the passed duration, or forever if it is zero.
+*/
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:     ttl,
+		records: make(map[string]memoryRecord),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Claim(ctx context.Context, key string, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.ttl > 0 && now.Sub(s.swept) > s.ttl {
+		for k, m := range s.records {
+			if now.After(m.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.swept = now
+	}
+
+	if m, ok := s.records[key]; ok && (m.expires.IsZero() || now.Before(m.expires)) {
+		return m.rec, nil
+	}
+	s.store(key, rec, now)
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, key string, rec *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(key, rec, time.Now())
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) store(key string, rec *IdempotencyRecord, now time.Time) {
+	m := memoryRecord{rec: rec}
+	if s.ttl > 0 {
+		m.expires = now.Add(s.ttl)
+	}
+	s.records[key] = m
+}
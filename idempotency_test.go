@@ -0,0 +1,223 @@
+package hiccup_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleResponseHandler_SetIdempotency() {
+	payments := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		payments++
+		return hiccup.Respond(http.StatusCreated).SetBody(map[string]int{"payment": payments})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetIdempotency(hiccup.NewMemoryIdempotencyStore(24 * time.Hour))
+
+	for i := 0; i < 2; i++ {
+		w, req := testRequest("POST", "/payments", strings.NewReader(`{"amount":100}`))
+		req.Header.Set("Idempotency-Key", "8e03978e")
+		handler.ServeHTTP(w, req)
+		fmt.Println(w.Code, w.Body.String(), w.Header().Get("Idempotent-Replayed") == "true")
+	}
+	// Output:
+	// 201 {"payment":1} false
+	// 201 {"payment":1} true
+}
+
+func TestResponseHandler_SetIdempotency(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		if r.URL.Query().Get("fail") != "" {
+			return hiccup.Respond(http.StatusServiceUnavailable).SetBody("try again")
+		}
+		return hiccup.Respond(http.StatusCreated).
+			SetBody(map[string]int{"calls": calls}).
+			SetCookies([]http.Cookie{{Name: "session", Value: "abc"}})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetIdempotency(hiccup.NewMemoryIdempotencyStore(0))
+
+	post := func(key string, body string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("POST", "/payments").
+			Header("Idempotency-Key", key).
+			RawBody("application/json", []byte(body))
+	}
+
+	hiccuptest.Do(t, handler, post("a", `{"amount":1}`).Accept("application/yaml")).
+		Status(http.StatusCreated).
+		Header("Idempotent-Replayed", "").
+		Text("calls: 1\n")
+
+	// replays keep the encoding and cookies of the first response.
+	hiccuptest.Do(t, handler, post("a", `{"amount":1}`).Accept("application/json")).
+		Status(http.StatusCreated).
+		ContentType("application/yaml").
+		Header("Set-Cookie", "session=abc").
+		Header("Idempotent-Replayed", "true").
+		Text("calls: 1\n")
+
+	hiccuptest.Do(t, handler, post("a", `{"amount":2}`)).
+		Status(http.StatusUnprocessableEntity).
+		ContentType("application/json")
+
+	// requests without a key, or of safe methods, are not recorded.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/payments")).Text(`{"calls":2}`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/payments").Header("Idempotency-Key", "a")).
+		Text(`{"calls":3}`)
+
+	// server errors release the key.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/payments?fail=1").Header("Idempotency-Key", "b")).
+		Status(http.StatusServiceUnavailable)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/payments?fail=1").Header("Idempotency-Key", "b")).
+		Status(http.StatusServiceUnavailable).
+		Header("Idempotent-Replayed", "")
+	if calls != 5 {
+		t.Error("unexpected handler calls", calls)
+		t.FailNow()
+	}
+}
+
+func TestResponseHandler_SetIdempotency_scope(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		user := r.Header.Get("Authorization")
+		return hiccup.Respond(http.StatusCreated).SetBody(map[string]string{"user": user})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetIdempotency(hiccup.NewMemoryIdempotencyStore(0)).
+		Use(func(next hiccup.HandlerFunc) hiccup.HandlerFunc {
+			return func(r *http.Request) *hiccup.Response {
+				if r.Header.Get("X-Blocked") != "" {
+					return hiccup.Respond(http.StatusTooManyRequests).SetBody("blocked")
+				}
+				return next(r).SetHeader("X-Middleware", "true")
+			}
+		})
+
+	post := func(auth string) *hiccuptest.Request {
+		req := hiccuptest.NewRequest("POST", "/payments").
+			Header("Idempotency-Key", "a").
+			RawBody("application/json", []byte(`{"amount":1}`))
+		if auth != "" {
+			req.Header("Authorization", auth)
+		}
+		return req
+	}
+
+	hiccuptest.Do(t, handler, post("alice")).Text(`{"user":"alice"}`)
+	hiccuptest.Do(t, handler, post("alice")).
+		Header("Idempotent-Replayed", "true").
+		Header("X-Middleware", "true").
+		Text(`{"user":"alice"}`)
+
+	// keys are scoped to the credentials of the request.
+	hiccuptest.Do(t, handler, post("")).
+		Header("Idempotent-Replayed", "").
+		Text(`{"user":""}`)
+	hiccuptest.Do(t, handler, post("mallory")).
+		Header("Idempotent-Replayed", "").
+		Text(`{"user":"mallory"}`)
+
+	// replays pass through middleware.
+	hiccuptest.Do(t, handler, post("alice").Header("X-Blocked", "1")).
+		Status(http.StatusTooManyRequests).
+		Header("Idempotent-Replayed", "")
+}
+
+func TestResponseHandler_SetIdempotency_principal(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusCreated).SetBody("payment of " + hiccup.Principal(r).(string))
+	}).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{
+			hiccup.APIKeyAuth("X-API-Key", func(ctx context.Context, key string) (any, error) {
+				return "user-" + key, nil
+			}),
+		},
+	}).SetIdempotency(hiccup.NewMemoryIdempotencyStore(0))
+
+	post := func(key string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("POST", "/payments").
+			Header("Idempotency-Key", "a").
+			Header("X-API-Key", key).
+			RawBody("application/json", []byte(`{"amount":1}`))
+	}
+
+	hiccuptest.Do(t, handler, post("alice")).Text("payment of user-alice")
+	hiccuptest.Do(t, handler, post("alice")).Header("Idempotent-Replayed", "true").Text("payment of user-alice")
+
+	// keys are scoped to the principal of the request.
+	hiccuptest.Do(t, handler, post("bob")).Header("Idempotent-Replayed", "").Text("payment of user-bob")
+}
+
+func TestResponseHandler_SetIdempotency_inFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Query().Get("panic") != "" {
+			panic("handler failed")
+		}
+		close(started)
+		<-release
+		return hiccup.Respond(http.StatusOK)
+	}).SetIdempotency(hiccup.NewMemoryIdempotencyStore(time.Minute))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hiccuptest.Do(t, handler, hiccuptest.NewRequest("PUT", "/").Header("Idempotency-Key", "a")).
+			Status(http.StatusOK)
+	}()
+
+	<-started
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("PUT", "/").Header("Idempotency-Key", "a")).
+		Status(http.StatusConflict)
+	close(release)
+	<-done
+
+	// a panicking handler releases the key.
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected handler panic")
+				}
+			}()
+			hiccuptest.Do(t, handler, hiccuptest.NewRequest("PUT", "/?panic=1").Header("Idempotency-Key", "b"))
+		}()
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	s := hiccup.NewMemoryIdempotencyStore(20 * time.Millisecond)
+
+	if prev, err := s.Claim(ctx, "a", &hiccup.IdempotencyRecord{Fingerprint: "1"}); prev != nil || err != nil {
+		t.Error("unexpected claim of unused key", prev, err)
+		t.FailNow()
+	}
+	s.Save(ctx, "a", &hiccup.IdempotencyRecord{Fingerprint: "1", Done: true, StatusCode: 201})
+	if prev, _ := s.Claim(ctx, "a", &hiccup.IdempotencyRecord{Fingerprint: "2"}); prev == nil || prev.StatusCode != 201 {
+		t.Error("expected stored record", prev)
+		t.FailNow()
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if prev, _ := s.Claim(ctx, "a", &hiccup.IdempotencyRecord{Fingerprint: "2"}); prev != nil {
+		t.Error("expected expired record", prev)
+		t.FailNow()
+	}
+
+	s.Release(ctx, "a")
+	if prev, _ := s.Claim(ctx, "a", &hiccup.IdempotencyRecord{}); prev != nil {
+		t.Error("expected released key", prev)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,675 @@
+/*
+Package jsonapi encodes and decodes JSON:API documents
+(https://jsonapi.org) for hiccup handlers.
+
+Resources are plain structs annotated with "jsonapi" struct tags:
+
+	type Article struct {
+		ID       string    `jsonapi:"primary,articles"`
+		Title    string    `jsonapi:"attr,title"`
+		Body     string    `jsonapi:"attr,body,omitempty"`
+		Author   *Person   `jsonapi:"relation,author"`
+		Comments []Comment `jsonapi:"relation,comments"`
+		Self     string    `jsonapi:"link,self"`
+	}
+
+The "primary" tag marks the resource id field, and names the resource type.
+Attribute values are encoded as json. Related resources are encoded as
+resource identifiers in the relationships of a resource, and in full in the
+"included" member of the document. Link fields hold the URL of a resource
+link.
+
+Use [Encoder] with [hiccup.Handler] to respond with JSON:API documents, and
+[Decoder] with [hiccup.Decoder] to unwrap request documents into structs.
+*/
+package jsonapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/afloesch/hiccup"
+)
+
+// ContentType is the JSON:API media type.
+const ContentType = "application/vnd.api+json"
+
+/*
+Encoder returns a [hiccup.ResponseEncoder] for JSON:API documents. The
+encoder reads the "fields[TYPE]" sparse fieldset and "include" query
+parameters of the request being served. Bodies of responses with a 4XX or
+5XX status code which are not resources, like the plain text error bodies
+of hiccup, are encoded as an errors document.
+*/
+func Encoder() hiccup.ResponseEncoder {
+	return codec{}
+}
+
+/*
+Decoder returns a [hiccup.BodyDecoder] which unwraps JSON:API documents into
+the annotated structs passed to [hiccup.RequestDecoder.DecodeBody].
+*/
+func Decoder() hiccup.BodyDecoder {
+	return codec{}
+}
+
+type codec struct{}
+
+func (codec) ContentType() string {
+	return ContentType
+}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	return Marshal(v)
+}
+
+func (codec) MarshalRequest(r *http.Request, v any) ([]byte, error) {
+	if status := hiccup.ResponseStatus(r); status >= 400 && !isResource(v) {
+		return MarshalError(status, v)
+	}
+	return MarshalOptions(v, optionsFromQuery(r))
+}
+
+/*
+isResource reports whether v is a resource struct, or a slice of them.
+*/
+func isResource(v any) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	_, err := modelOf(t)
+	return err == nil
+}
+
+type errorDocument struct {
+	Errors []*errorObject `json:"errors"`
+}
+
+type errorObject struct {
+	Status string `json:"status"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+/*
+MarshalError encodes an error body of a response with the passed status
+code as a JSON:API errors document. The title and detail of a
+[hiccup.Problem] are kept, and other bodies are sent as the detail.
+*/
+func MarshalError(status int, v any) ([]byte, error) {
+	obj := &errorObject{Status: strconv.Itoa(status)}
+	switch e := v.(type) {
+	case nil:
+		obj.Title = http.StatusText(status)
+	case *hiccup.Problem:
+		obj.Title, obj.Detail = e.Title, e.Detail
+	case hiccup.Problem:
+		obj.Title, obj.Detail = e.Title, e.Detail
+	case error:
+		obj.Detail = e.Error()
+	default:
+		obj.Detail = fmt.Sprint(e)
+	}
+	return json.Marshal(errorDocument{Errors: []*errorObject{obj}})
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	return Unmarshal(data, v)
+}
+
+/*
+Options control the content of an encoded document.
+*/
+type Options struct {
+	// Sparse fieldsets keyed by resource type. Resources of a listed type
+	// only include the listed attributes and relationships.
+	Fields map[string][]string
+	// Relationship paths of the resources to include, like "author" or
+	// "comments.author". If nil, every related resource is included.
+	Include []string
+}
+
+func optionsFromQuery(r *http.Request) Options {
+	var opts Options
+	q := r.URL.Query()
+	for key, values := range q {
+		if !strings.HasPrefix(key, "fields[") || !strings.HasSuffix(key, "]") || len(values) == 0 {
+			continue
+		}
+		if opts.Fields == nil {
+			opts.Fields = make(map[string][]string)
+		}
+		typ := key[len("fields[") : len(key)-1]
+		opts.Fields[typ] = splitList(values[0])
+	}
+	if q.Has("include") {
+		opts.Include = splitList(q.Get("include"))
+	}
+	return opts
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+/*
+Marshal encodes a resource struct, or a slice of resource structs, as a
+JSON:API document with every related resource included. A nil value is
+encoded as a document with null data.
+*/
+func Marshal(v any) ([]byte, error) {
+	return MarshalOptions(v, Options{})
+}
+
+/*
+MarshalOptions encodes a resource struct, or a slice of resource structs, as
+a JSON:API document with the passed [Options].
+*/
+func MarshalOptions(v any, opts Options) ([]byte, error) {
+	e := &encoder{
+		fields: make(map[string]map[string]bool),
+		seen:   make(map[string]bool),
+	}
+	for typ, names := range opts.Fields {
+		e.fields[typ] = make(map[string]bool)
+		for _, name := range names {
+			e.fields[typ][name] = true
+		}
+	}
+
+	var include [][]string
+	if opts.Include != nil {
+		include = [][]string{}
+		for _, path := range opts.Include {
+			include = append(include, strings.Split(path, "."))
+		}
+	}
+
+	doc := document{}
+	rv := indirect(reflect.ValueOf(v))
+	switch {
+	case !rv.IsValid():
+		doc.Data = nil
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		data := make([]*resource, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			res, err := e.primary(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, res)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.includeRelated(indirect(rv.Index(i)), include); err != nil {
+				return nil, err
+			}
+		}
+		doc.Data = data
+	default:
+		res, err := e.primary(rv)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.includeRelated(rv, include); err != nil {
+			return nil, err
+		}
+		doc.Data = res
+	}
+
+	doc.Included = e.included
+	return json.Marshal(doc)
+}
+
+type document struct {
+	Data     any         `json:"data"`
+	Included []*resource `json:"included,omitempty"`
+}
+
+type resource struct {
+	Type          string                   `json:"type"`
+	ID            string                   `json:"id,omitempty"`
+	Attributes    map[string]any           `json:"attributes,omitempty"`
+	Relationships map[string]*relationship `json:"relationships,omitempty"`
+	Links         map[string]string        `json:"links,omitempty"`
+}
+
+type relationship struct {
+	Data any `json:"data"`
+}
+
+type identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type encoder struct {
+	fields   map[string]map[string]bool
+	seen     map[string]bool
+	included []*resource
+}
+
+func (e *encoder) primary(v reflect.Value) (*resource, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, errors.New("jsonapi: nil resource in primary data")
+	}
+	res, err := e.resource(v)
+	if err != nil {
+		return nil, err
+	}
+	e.seen[res.Type+"/"+res.ID] = true
+	return res, nil
+}
+
+func (e *encoder) resource(v reflect.Value) (*resource, error) {
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jsonapi: %s is not a resource struct", v.Type())
+	}
+	m, err := modelOf(v.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &resource{Type: m.typ, ID: formatID(v.Field(m.id))}
+	fields := e.fields[m.typ]
+	for _, f := range m.fields {
+		if fields != nil && f.kind != kindLink && !fields[f.name] {
+			continue
+		}
+
+		fv := v.Field(f.index)
+		switch f.kind {
+		case kindAttr:
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			if res.Attributes == nil {
+				res.Attributes = make(map[string]any)
+			}
+			res.Attributes[f.name] = fv.Interface()
+		case kindRelation:
+			rel, err := relationshipOf(fv)
+			if err != nil {
+				return nil, err
+			}
+			if res.Relationships == nil {
+				res.Relationships = make(map[string]*relationship)
+			}
+			res.Relationships[f.name] = rel
+		case kindLink:
+			if fv.String() == "" {
+				continue
+			}
+			if res.Links == nil {
+				res.Links = make(map[string]string)
+			}
+			res.Links[f.name] = fv.String()
+		}
+	}
+	return res, nil
+}
+
+/*
+includeRelated adds the related resources of v to the included resources.
+A nil include list includes every related resource.
+*/
+func (e *encoder) includeRelated(v reflect.Value, include [][]string) error {
+	m, err := modelOf(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range m.fields {
+		if f.kind != kindRelation {
+			continue
+		}
+
+		var next [][]string
+		if include != nil {
+			next = [][]string{}
+			matched := false
+			for _, path := range include {
+				if path[0] == f.name {
+					matched = true
+					if len(path) > 1 {
+						next = append(next, path[1:])
+					}
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		for _, rv := range related(v.Field(f.index)) {
+			res, err := e.resource(rv)
+			if err != nil {
+				return err
+			}
+			key := res.Type + "/" + res.ID
+			if e.seen[key] {
+				continue
+			}
+			e.seen[key] = true
+			e.included = append(e.included, res)
+			if err := e.includeRelated(rv, next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func relationshipOf(v reflect.Value) (*relationship, error) {
+	identifierOf := func(rv reflect.Value) (*identifier, error) {
+		m, err := modelOf(rv.Type())
+		if err != nil {
+			return nil, err
+		}
+		return &identifier{Type: m.typ, ID: formatID(rv.Field(m.id))}, nil
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		data := []*identifier{}
+		for _, rv := range related(v) {
+			id, err := identifierOf(rv)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, id)
+		}
+		return &relationship{Data: data}, nil
+	}
+
+	rv := indirect(v)
+	if !rv.IsValid() {
+		return &relationship{Data: nil}, nil
+	}
+	id, err := identifierOf(rv)
+	if err != nil {
+		return nil, err
+	}
+	return &relationship{Data: id}, nil
+}
+
+/*
+related returns the non-nil resource structs of a relation field value.
+*/
+func related(v reflect.Value) []reflect.Value {
+	var values []reflect.Value
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if rv := indirect(v.Index(i)); rv.IsValid() {
+				values = append(values, rv)
+			}
+		}
+		return values
+	}
+	if rv := indirect(v); rv.IsValid() {
+		values = append(values, rv)
+	}
+	return values
+}
+
+/*
+Unmarshal decodes a JSON:API document into a resource struct, or a slice
+of resource structs, passed as a pointer. Relationships are decoded into
+related structs with only the id field set. Resource types which do not
+match the type of the struct are an error.
+*/
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("jsonapi: unmarshal requires a non-nil pointer")
+	}
+
+	var doc struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Data) == 0 || string(doc.Data) == "null" {
+		return nil
+	}
+
+	target := rv.Elem()
+	if target.Kind() == reflect.Slice {
+		var list []json.RawMessage
+		if err := json.Unmarshal(doc.Data, &list); err != nil {
+			return err
+		}
+		out := reflect.MakeSlice(target.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := unmarshalResource(item, out.Index(i)); err != nil {
+				return err
+			}
+		}
+		target.Set(out)
+		return nil
+	}
+	return unmarshalResource(doc.Data, target)
+}
+
+func unmarshalResource(data []byte, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("jsonapi: %s is not a resource struct", v.Type())
+	}
+	m, err := modelOf(v.Type())
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Type          string                     `json:"type"`
+		ID            string                     `json:"id"`
+		Attributes    map[string]json.RawMessage `json:"attributes"`
+		Relationships map[string]struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"relationships"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	if res.Type != m.typ {
+		return fmt.Errorf("jsonapi: resource type %q does not match %q", res.Type, m.typ)
+	}
+	if err := parseID(res.ID, v.Field(m.id)); err != nil {
+		return err
+	}
+
+	for _, f := range m.fields {
+		fv := v.Field(f.index)
+		switch f.kind {
+		case kindAttr:
+			if raw, ok := res.Attributes[f.name]; ok {
+				if err := json.Unmarshal(raw, fv.Addr().Interface()); err != nil {
+					return fmt.Errorf("jsonapi: attribute %q: %w", f.name, err)
+				}
+			}
+		case kindRelation:
+			rel, ok := res.Relationships[f.name]
+			if !ok {
+				continue
+			}
+			if err := unmarshalRelation(rel.Data, fv); err != nil {
+				return fmt.Errorf("jsonapi: relationship %q: %w", f.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func unmarshalRelation(data json.RawMessage, v reflect.Value) error {
+	if len(data) == 0 || string(data) == "null" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice {
+		var ids []json.RawMessage
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return err
+		}
+		out := reflect.MakeSlice(v.Type(), len(ids), len(ids))
+		for i, id := range ids {
+			if err := unmarshalResource(id, out.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(out)
+		return nil
+	}
+	return unmarshalResource(data, v)
+}
+
+const (
+	kindAttr = iota
+	kindRelation
+	kindLink
+)
+
+type model struct {
+	typ    string
+	id     int
+	fields []modelField
+}
+
+type modelField struct {
+	kind      int
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var models sync.Map
+
+/*
+modelOf parses the "jsonapi" struct tags of a resource struct type.
+*/
+func modelOf(t reflect.Type) (*model, error) {
+	if m, ok := models.Load(t); ok {
+		return m.(*model), nil
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jsonapi: %s is not a struct", t)
+	}
+
+	m := &model{id: -1}
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("jsonapi")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if len(parts) < 2 || parts[1] == "" {
+			return nil, fmt.Errorf("jsonapi: invalid tag %q on %s.%s", tag, t, t.Field(i).Name)
+		}
+
+		f := modelField{name: parts[1], index: i}
+		switch parts[0] {
+		case "primary":
+			m.typ = parts[1]
+			m.id = i
+			continue
+		case "attr":
+			f.kind = kindAttr
+			f.omitEmpty = len(parts) > 2 && parts[2] == "omitempty"
+		case "relation":
+			f.kind = kindRelation
+		case "link":
+			f.kind = kindLink
+		default:
+			return nil, fmt.Errorf("jsonapi: invalid tag %q on %s.%s", tag, t, t.Field(i).Name)
+		}
+		m.fields = append(m.fields, f)
+	}
+	if m.id < 0 {
+		return nil, fmt.Errorf("jsonapi: %s has no primary field", t)
+	}
+
+	models.Store(t, m)
+	return m, nil
+}
+
+func formatID(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 {
+			return ""
+		}
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func parseID(id string, v reflect.Value) error {
+	if id == "" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(id)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("jsonapi: invalid id %q: %w", id, err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("jsonapi: invalid id %q: %w", id, err)
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("jsonapi: unsupported id type %s", v.Type())
+	}
+	return nil
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
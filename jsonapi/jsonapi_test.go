@@ -0,0 +1,330 @@
+package jsonapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/jsonapi"
+)
+
+type person struct {
+	ID   int    `jsonapi:"primary,people"`
+	Name string `jsonapi:"attr,name"`
+}
+
+type comment struct {
+	ID     string  `jsonapi:"primary,comments"`
+	Body   string  `jsonapi:"attr,body"`
+	Author *person `jsonapi:"relation,author"`
+}
+
+type article struct {
+	ID       string    `jsonapi:"primary,articles"`
+	Title    string    `jsonapi:"attr,title"`
+	Summary  string    `jsonapi:"attr,summary,omitempty"`
+	Author   *person   `jsonapi:"relation,author"`
+	Comments []comment `jsonapi:"relation,comments"`
+	Self     string    `jsonapi:"link,self"`
+	Ignored  string
+}
+
+func testArticle() *article {
+	jane := &person{ID: 1, Name: "Jane"}
+	john := &person{ID: 2, Name: "John"}
+	return &article{
+		ID:     "10",
+		Title:  "Hello",
+		Author: jane,
+		Comments: []comment{
+			{ID: "100", Body: "First", Author: john},
+			{ID: "101", Body: "Second", Author: jane},
+		},
+		Self: "/articles/10",
+	}
+}
+
+func ExampleEncoder() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(testArticle())
+	}, jsonapi.Encoder())
+
+	// request a sparse fieldset, and only include the author.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/articles/10?fields[articles]=title,author&include=author", nil))
+
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Println(string(body))
+	// Output: {"data":{"type":"articles","id":"10","attributes":{"title":"Hello"},"relationships":{"author":{"data":{"type":"people","id":"1"}}},"links":{"self":"/articles/10"}},"included":[{"type":"people","id":"1","attributes":{"name":"Jane"}}]}
+}
+
+func ExampleDecoder() {
+	dec := hiccup.Decoder(jsonapi.Decoder())
+
+	body := `{"data":{"type":"articles","attributes":{"title":"Hello"},"relationships":{"author":{"data":{"type":"people","id":"1"}}}}}`
+	req := httptest.NewRequest("POST", "/articles", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", jsonapi.ContentType)
+
+	var a article
+	dec.DecodeBody(req, &a)
+	fmt.Println(a.Title, a.Author.ID)
+	// Output: Hello 1
+}
+
+func TestMarshal(t *testing.T) {
+	b, err := jsonapi.Marshal(testArticle())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	var doc struct {
+		Data struct {
+			Type          string
+			ID            string
+			Attributes    map[string]any
+			Relationships map[string]struct{ Data any }
+		}
+		Included []struct {
+			Type string
+			ID   string
+		}
+	}
+	json.Unmarshal(b, &doc)
+	if doc.Data.Type != "articles" || doc.Data.ID != "10" || doc.Data.Attributes["title"] != "Hello" {
+		t.Error("unexpected primary data", string(b))
+		t.FailNow()
+	}
+	if _, ok := doc.Data.Attributes["summary"]; ok {
+		t.Error("empty attribute not omitted")
+		t.FailNow()
+	}
+	if comments, ok := doc.Data.Relationships["comments"].Data.([]any); !ok || len(comments) != 2 {
+		t.Error("unexpected comments relationship", doc.Data.Relationships)
+		t.FailNow()
+	}
+
+	var included []string
+	for _, res := range doc.Included {
+		included = append(included, res.Type+"/"+res.ID)
+	}
+	if fmt.Sprint(included) != "[people/1 comments/100 people/2 comments/101]" {
+		t.Error("unexpected included resources", included)
+		t.FailNow()
+	}
+
+	// nested include paths.
+	b, _ = jsonapi.MarshalOptions(testArticle(), jsonapi.Options{Include: []string{"comments.author"}})
+	json.Unmarshal(b, &doc)
+	included = nil
+	for _, res := range doc.Included {
+		included = append(included, res.Type+"/"+res.ID)
+	}
+	if fmt.Sprint(included) != "[comments/100 people/2 comments/101 people/1]" {
+		t.Error("unexpected included resources", included)
+		t.FailNow()
+	}
+
+	// collections, and resources included by a primary resource.
+	a := testArticle()
+	b, _ = jsonapi.MarshalOptions([]any{a, a.Author}, jsonapi.Options{Include: []string{}})
+	if bytes.Contains(b, []byte("included")) {
+		t.Error("unexpected included resources", string(b))
+		t.FailNow()
+	}
+	b, _ = jsonapi.Marshal([]*person{a.Author})
+	if string(b) != `{"data":[{"type":"people","id":"1","attributes":{"name":"Jane"}}]}` {
+		t.Error("unexpected collection", string(b))
+		t.FailNow()
+	}
+
+	b, _ = jsonapi.Marshal(&article{ID: "1"})
+	if string(b) != `{"data":{"type":"articles","id":"1","attributes":{"title":""},"relationships":{"author":{"data":null},"comments":{"data":[]}}}}` {
+		t.Error("unexpected empty relationships", string(b))
+		t.FailNow()
+	}
+
+	b, _ = jsonapi.Marshal(nil)
+	if string(b) != `{"data":null}` {
+		t.Error("unexpected null document", string(b))
+		t.FailNow()
+	}
+
+	type noPrimary struct {
+		Name string `jsonapi:"attr,name"`
+	}
+	type badTag struct {
+		ID string `jsonapi:"primary"`
+	}
+	type unknownTag struct {
+		ID string `jsonapi:"other,x"`
+	}
+	type badRelation struct {
+		ID  string    `jsonapi:"primary,bad"`
+		Rel noPrimary `jsonapi:"relation,rel"`
+	}
+	type badRelations struct {
+		ID  string      `jsonapi:"primary,bad"`
+		Rel []noPrimary `jsonapi:"relation,rel"`
+	}
+	type scalarRelations struct {
+		ID  string   `jsonapi:"primary,bad"`
+		Rel []string `jsonapi:"relation,rel"`
+	}
+	type scalarRelation struct {
+		ID  string  `jsonapi:"primary,bad"`
+		Rel *string `jsonapi:"relation,rel"`
+	}
+	rel := "a"
+	for _, v := range []any{noPrimary{}, badTag{}, unknownTag{}, badRelation{}, badRelations{Rel: []noPrimary{{}}}, "text", []*person{nil}, []string{"a"},
+		scalarRelations{Rel: []string{"a"}}, scalarRelation{Rel: &rel}} {
+		if _, err := jsonapi.Marshal(v); err == nil {
+			t.Error("expected a marshal error", v)
+			t.FailNow()
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	b, _ := jsonapi.Marshal(testArticle())
+	var a article
+	if err := jsonapi.Unmarshal(b, &a); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	want := article{
+		ID:       "10",
+		Title:    "Hello",
+		Author:   &person{ID: 1},
+		Comments: []comment{{ID: "100"}, {ID: "101"}},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("unexpected article %+v", a)
+		t.FailNow()
+	}
+
+	var people []*person
+	err := jsonapi.Unmarshal([]byte(`{"data":[{"type":"people","id":"1","attributes":{"name":"Jane"}}]}`), &people)
+	if err != nil || len(people) != 1 || people[0].Name != "Jane" {
+		t.Error("unexpected collection", err, people)
+		t.FailNow()
+	}
+
+	a = article{Author: &person{ID: 5}}
+	if err := jsonapi.Unmarshal([]byte(`{"data":{"type":"articles","relationships":{"author":{"data":null}}}}`), &a); err != nil || a.Author != nil {
+		t.Error("relationship not cleared", err, a.Author)
+		t.FailNow()
+	}
+	if err := jsonapi.Unmarshal([]byte(`{"data":null}`), &a); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	type unsigned struct {
+		ID uint8 `jsonapi:"primary,unsigned"`
+	}
+	var u unsigned
+	if err := jsonapi.Unmarshal([]byte(`{"data":{"type":"unsigned","id":"7"}}`), &u); err != nil || u.ID != 7 {
+		t.Error("unexpected unsigned id", err, u)
+		t.FailNow()
+	}
+	b, _ = jsonapi.Marshal(u)
+	if string(b) != `{"data":{"type":"unsigned","id":"7"}}` {
+		t.Error("unexpected unsigned id", string(b))
+		t.FailNow()
+	}
+
+	type floatID struct {
+		ID float64 `jsonapi:"primary,floats"`
+	}
+	b, _ = jsonapi.Marshal(floatID{ID: 1.5})
+	if string(b) != `{"data":{"type":"floats","id":"1.5"}}` {
+		t.Error("unexpected float id", string(b))
+		t.FailNow()
+	}
+
+	errs := []struct {
+		data string
+		v    any
+	}{
+		{`{"data":{"type":"people","id":"1"}}`, a},
+		{`{`, &a},
+		{`{"data":{"type":"people","id":"1"}}`, &a},
+		{`{"data":{"type":"people","id":"x"}}`, &person{}},
+		{`{"data":{"type":"unsigned","id":"-1"}}`, &unsigned{}},
+		{`{"data":{"type":"floats","id":"1"}}`, &floatID{}},
+		{`{"data":{"type":"people","attributes":{"name":1}}}`, &person{}},
+		{`{"data":{"type":"articles","relationships":{"author":{"data":{"type":"comments","id":"1"}}}}}`, &article{}},
+		{`{"data":{"type":"articles","relationships":{"comments":{"data":{}}}}}`, &article{}},
+		{`{"data":{"type":"articles","relationships":{"comments":{"data":[{"type":"people"}]}}}}`, &article{}},
+		{`{"data":{}}`, &people},
+		{`{"data":[{"type":"articles"}]}`, &people},
+		{`{"data":{"type":1}}`, &a},
+		{`{"data":{"type":"x"}}`, new(string)},
+		{`{"data":{"type":"x"}}`, new(struct{ ID string })},
+	}
+	for _, e := range errs {
+		if err := jsonapi.Unmarshal([]byte(e.data), e.v); err == nil {
+			t.Error("expected an unmarshal error", e.data)
+			t.FailNow()
+		}
+	}
+}
+
+func TestEncoder_Errors(t *testing.T) {
+	handler := hiccup.Resource(hiccup.Methods{
+		http.MethodGet: func(r *http.Request) *hiccup.Response {
+			switch r.URL.Path {
+			case "/missing":
+				return hiccup.RespondProblem(http.StatusNotFound, "no article 10")
+			case "/invalid":
+				return hiccup.Respond(http.StatusUnprocessableEntity).SetBody(testArticle())
+			}
+			return hiccup.Respond(http.StatusOK).SetBody(testArticle())
+		},
+	}, jsonapi.Encoder()).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{
+			hiccup.APIKeyAuth("X-Api-Key", func(ctx context.Context, key string) (any, error) {
+				return key, nil
+			}),
+		},
+	})
+
+	for _, tc := range []struct {
+		method, path, key string
+		status            int
+		body              string
+	}{
+		{"GET", "/", "", http.StatusUnauthorized, `{"errors":[{"status":"401","detail":"Unauthorized"}]}`},
+		{"DELETE", "/", "a", http.StatusMethodNotAllowed, `{"errors":[{"status":"405","detail":"Method Not Allowed"}]}`},
+		{"GET", "/missing", "a", http.StatusNotFound, `{"errors":[{"status":"404","title":"Not Found","detail":"no article 10"}]}`},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set("X-Api-Key", tc.key)
+		}
+		handler.ServeHTTP(w, req)
+		if w.Code != tc.status || w.Header().Get("Content-Type") != jsonapi.ContentType || w.Body.String() != tc.body {
+			t.Error("unexpected error response", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			t.FailNow()
+		}
+	}
+
+	// resource bodies are encoded as resources whatever the status.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/invalid", nil)
+	req.Header.Set("X-Api-Key", "a")
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity || !bytes.HasPrefix(w.Body.Bytes(), []byte(`{"data":{"type":"articles"`)) {
+		t.Error("unexpected resource error response", w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,155 @@
+package hiccup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+SetLogger sets a [slog.Logger] to emit one structured record for every
+request served by the handler. A record holds the request method and path,
+the response status, the "Accept" header value sent, the "Content-Type"
+written, the encoder used, the body bytes written, the request duration,
+the [RequestID] if enabled, and any error encountered serving the request.
+
+Errors which do not otherwise fail a request are included, like invalid
+"Accept" or "Content-Type" header values, marshal errors sent as plain
+text, body write errors, and errors returned by [RequestDecoder.DecodeBody].
+
+Records are logged at the error level for 5XX responses, at the warn level
+if any error was encountered, and at the info level otherwise.
+*/
+func (h *ResponseHandler) SetLogger(l *slog.Logger) *ResponseHandler {
+	h.logger = l
+	return h
+}
+
+/*
+requestLog collects the details of a single request for its log record.
+*/
+type requestLog struct {
+	mu      sync.Mutex
+	encoder string
+	errs    []error
+}
+
+type requestLogKey struct{}
+
+func withRequestLog(ctx context.Context, l *requestLog) context.Context {
+	return context.WithValue(ctx, requestLogKey{}, l)
+}
+
+/*
+logError adds an error to the log record of the request context, if the
+request is logged.
+*/
+func logError(ctx context.Context, err error) {
+	if l, ok := ctx.Value(requestLogKey{}).(*requestLog); ok && err != nil {
+		l.mu.Lock()
+		l.errs = append(l.errs, err)
+		l.mu.Unlock()
+	}
+}
+
+/*
+logEncoder sets the encoder content type of the log record of the request
+context, if the request is logged.
+*/
+func logEncoder(ctx context.Context, contentType string) {
+	if l, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		l.mu.Lock()
+		l.encoder = contentType
+		l.mu.Unlock()
+	}
+}
+
+func (h *ResponseHandler) log(r *http.Request, w *logWriter, l *requestLog, start time.Time) {
+	l.mu.Lock()
+	errs := append([]error{}, l.errs...)
+	l.mu.Unlock()
+	if w.err != nil {
+		errs = append(errs, w.err)
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", w.status),
+		slog.String("accept", r.Header.Get("Accept")),
+		slog.String("content_type", w.Header().Get("Content-Type")),
+		slog.String("encoder", l.encoder),
+		slog.Int("bytes", w.bytes),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if id := RequestID(r); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	level := slog.LevelInfo
+	if len(errs) > 0 {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", errors.Join(errs...).Error()))
+	}
+	if w.status >= 500 {
+		level = slog.LevelError
+	}
+	h.logger.LogAttrs(r.Context(), level, "request", attrs...)
+}
+
+/*
+logWriter wraps a [http.ResponseWriter] to record the status code, body
+bytes, and first write error of a response.
+*/
+type logWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	err    error
+}
+
+func (w *logWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+/*
+ReadFrom copies the body with the [io.ReaderFrom] of the wrapped writer if
+it has one, so files are still sent with sendfile.
+*/
+func (w *logWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := io.Copy(w.ResponseWriter, src)
+	w.bytes += int(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+/*
+Unwrap returns the wrapped writer, for [http.ResponseController].
+*/
+func (w *logWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,177 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+)
+
+// failWriter fails every body write.
+type failWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w *failWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func ExampleResponseHandler_SetLogger() {
+	// drop the time and duration attributes for a stable example output.
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"Message": "Hello World!"})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).SetLogger(logger)
+
+	w, req := testRequest("GET", "/hello", nil)
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, req)
+	// Output: level=INFO msg=request method=GET path=/hello status=200 accept=application/json content_type=application/json encoder=application/json bytes=26
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		records = append(records, rec)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestResponseHandler_SetLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	dec := hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal))
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		var m map[string]string
+		if _, err := dec.DecodeBody(r, &m); err != nil {
+			return hiccup.Respond(http.StatusBadRequest).SetBody(err.Error())
+		}
+		if r.URL.Path == "/fail" {
+			return hiccup.Respond(http.StatusOK).SetBody(m)
+		}
+		return hiccup.Respond(http.StatusCreated).SetBody(m)
+	}, hiccup.WithEncoder("application/json", json.Marshal), hiccup.WithEncoder("test/failed", testFailMarshal)).
+		SetLogger(logger)
+
+	w, req := testRequest("POST", "/articles", bytes.NewBufferString(`{"a":"b"}`))
+	handler.ServeHTTP(w, req)
+	rec := logRecords(t, buf)[0]
+	if rec["level"] != "INFO" || rec["method"] != "POST" || rec["path"] != "/articles" ||
+		rec["status"] != float64(201) || rec["bytes"] != float64(9) || rec["error"] != nil {
+		t.Error("unexpected log record", rec)
+		t.FailNow()
+	}
+
+	// decode and header parsing errors are logged.
+	w, req = testRequest("POST", "/", bytes.NewBufferString(`{`))
+	req.Header.Set("Content-Type", "application/json;;")
+	req.Header.Set("Accept", "/json")
+	handler.ServeHTTP(w, req)
+	rec = logRecords(t, buf)[0]
+	if rec["level"] != "WARN" || rec["status"] != float64(400) || rec["encoder"] != "application/json" {
+		t.Error("unexpected log record", rec)
+		t.FailNow()
+	}
+	msg, _ := rec["error"].(string)
+	if !strings.Contains(msg, "parsing accept header") ||
+		!strings.Contains(msg, "parsing content type header") ||
+		!strings.Contains(msg, "decoding request body") {
+		t.Error("missing errors", msg)
+		t.FailNow()
+	}
+
+	// marshal fallbacks are logged as errors.
+	w, req = testRequest("POST", "/fail", bytes.NewBufferString(`{"a":"b"}`))
+	req.Header.Set("Accept", "test/failed")
+	handler.ServeHTTP(w, req)
+	rec = logRecords(t, buf)[0]
+	if rec["level"] != "ERROR" || rec["status"] != float64(500) || rec["content_type"] != "text/plain; charset=utf-8" ||
+		!strings.Contains(rec["error"].(string), "sent as plain text: marshal failed") {
+		t.Error("unexpected log record", rec)
+		t.FailNow()
+	}
+
+	// body write errors are logged.
+	fw := &failWriter{httptest.NewRecorder()}
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"a":"b"}`))
+	handler.ServeHTTP(fw, req)
+	rec = logRecords(t, buf)[0]
+	if rec["error"] != "connection reset" || rec["bytes"] != float64(0) {
+		t.Error("unexpected log record", rec)
+		t.FailNow()
+	}
+
+}
+
+// readFromWriter records calls to ReadFrom.
+type readFromWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (w *readFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+// flushBody flushes the response after writing its content.
+type flushBody string
+
+func (b flushBody) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(b))
+	if err == nil {
+		err = http.NewResponseController(w.(http.ResponseWriter)).Flush()
+	}
+	return int64(n), err
+}
+
+func TestResponseHandler_SetLoggerUnwrap(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Path == "/flush" {
+			return hiccup.Respond(http.StatusOK).SetRaw("text/plain", flushBody("Hello"))
+		}
+		return hiccup.Respond(http.StatusOK).SetRaw("", io.LimitReader(strings.NewReader("Hello"), 5))
+	}).SetLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	w := &readFromWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.readFrom || w.Body.String() != "Hello" {
+		t.Error("body not copied with ReadFrom", w.readFrom, w.Body.String())
+		t.FailNow()
+	}
+	if rec := logRecords(t, buf)[0]; rec["bytes"] != float64(5) {
+		t.Error("unexpected log record", rec)
+		t.FailNow()
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/flush", nil))
+	if !rec.Flushed || rec.Body.String() != "Hello" {
+		t.Error("response not flushed", rec.Flushed, rec.Body.String())
+		t.FailNow()
+	}
+}
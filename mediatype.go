@@ -0,0 +1,237 @@
+package hiccup
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+MediaType is a parsed media type, like "application/vnd.acme.v2+json" or
+"application/json; version=2".
+
+Encoders and decoders can be registered with media type parameters and
+vendor types. When matching a request media type, parameters registered
+with a codec must be sent with the same values, and a vendor type with a
+structured syntax suffix, like "+json", "+yaml", or "+xml", falls back to
+the generic codec for the suffix, like "application/json".
+*/
+type MediaType struct {
+	// Top level type, like "application".
+	Type string
+	// Subtype including any suffix, like "vnd.acme.v2+json".
+	Subtype string
+	// Media type parameters with lower case names.
+	Params map[string]string
+}
+
+/*
+ParseMediaType parses a media type value, like the value of a
+"Content-Type" header.
+*/
+func ParseMediaType(s string) (MediaType, error) {
+	t, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return MediaType{}, err
+	}
+
+	m := MediaType{Params: params}
+	m.Type, m.Subtype, _ = strings.Cut(t, "/")
+	return m, nil
+}
+
+/*
+mediaTypeOf parses a registered codec content type. Values which cannot be
+parsed are kept as the type, so they still match themselves.
+*/
+func mediaTypeOf(s string) MediaType {
+	m, err := ParseMediaType(s)
+	if err != nil {
+		return MediaType{Type: strings.ToLower(strings.TrimSpace(s))}
+	}
+	return m
+}
+
+/*
+Essence returns the media type without parameters, like "application/json".
+*/
+func (m MediaType) Essence() string {
+	if m.Subtype == "" {
+		return m.Type
+	}
+	return m.Type + "/" + m.Subtype
+}
+
+/*
+Suffix returns the structured syntax suffix of the subtype without the
+"+", like "json" for "application/vnd.acme+json", or "" if there is none.
+*/
+func (m MediaType) Suffix() string {
+	if i := strings.LastIndexByte(m.Subtype, '+'); i >= 0 {
+		return m.Subtype[i+1:]
+	}
+	return ""
+}
+
+/*
+Version returns the requested API version of the media type. It is read
+from a "version" parameter, like "application/json; version=2", or from a
+vendor subtype segment, like "application/vnd.acme.v2+json". It returns ""
+if no version is set.
+*/
+func (m MediaType) Version() string {
+	if v := m.Params["version"]; v != "" {
+		return v
+	}
+
+	sub := strings.TrimSuffix(m.Subtype, "+"+m.Suffix())
+	if !strings.HasPrefix(sub, "vnd.") {
+		return ""
+	}
+	segs := strings.Split(sub, ".")
+	for i, seg := range segs {
+		if len(seg) < 2 || seg[0] != 'v' || !isDigits(seg[1:]) {
+			continue
+		}
+		// minor versions follow as numeric segments, like "v1.2".
+		v := seg[1:]
+		for _, minor := range segs[i+1:] {
+			if !isDigits(minor) {
+				break
+			}
+			v += "." + minor
+		}
+		return v
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+/*
+String formats the media type with its parameters.
+*/
+func (m MediaType) String() string {
+	if s := mime.FormatMediaType(m.Essence(), m.Params); s != "" {
+		return s
+	}
+	return m.Essence()
+}
+
+/*
+matchMediaType returns the index of the registered media type which best
+matches the wanted media type, or -1 if none does. A registered type with
+the same essence matches if its parameters are all sent with the same
+values, and more matching parameters make a better match. A generic type
+matches a vendor type with its structured syntax suffix.
+*/
+func matchMediaType(registered []MediaType, want MediaType) int {
+	best, bestScore := -1, 0
+	suffix := want.Suffix()
+	for i, m := range registered {
+		if !paramsSubset(m.Params, want.Params) {
+			continue
+		}
+
+		score := 0
+		switch {
+		case m.Essence() == want.Essence():
+			score = 2 + len(m.Params)
+		case suffix != "" && (m.Subtype == suffix || m.Subtype == "x-"+suffix):
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+func paramsSubset(params map[string]string, of map[string]string) bool {
+	for k, v := range params {
+		if of[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+acceptRange is a single media range of an "Accept" header value.
+*/
+type acceptRange struct {
+	MediaType
+	q float64
+}
+
+/*
+parseAccept parses an "Accept" header value into media ranges ordered by
+preference. Ranges with a quality of zero are dropped. Any invalid range
+is skipped and reported in the returned error.
+*/
+func parseAccept(s string) ([]acceptRange, error) {
+	var ranges []acceptRange
+	var firstErr error
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		m, err := ParseMediaType(part)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		r := acceptRange{MediaType: m, q: 1}
+		if v, ok := m.Params["q"]; ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil {
+				r.q = q
+			}
+			delete(m.Params, "q")
+		}
+		if r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges, firstErr
+}
+
+type negotiatedKey struct{}
+
+func withNegotiated(ctx context.Context, m MediaType) context.Context {
+	return context.WithValue(ctx, negotiatedKey{}, m)
+}
+
+/*
+Negotiated returns the media type negotiated for the response of a request
+served by a [ResponseHandler]. It is the media range sent in the "Accept"
+header which was matched, including any parameters, or the content type
+of the selected encoder if the match was made with a wildcard or default
+encoder.
+
+Handlers can use it to shape the response for the requested version:
+
+	if hiccup.Negotiated(r).Version() == "2" {
+		...
+	}
+*/
+func Negotiated(r *http.Request) MediaType {
+	m, _ := r.Context().Value(negotiatedKey{}).(MediaType)
+	return m
+}
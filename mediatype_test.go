@@ -0,0 +1,129 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleNegotiated() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if hiccup.Negotiated(r).Version() == "2" {
+			return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"name": "Jane Doe"})
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"first": "Jane", "last": "Doe"})
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	for _, accept := range []string{"application/vnd.acme.v2+json", "application/json; version=1"} {
+		w, req := testRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		handler.ServeHTTP(w, req)
+
+		fmt.Println(w.Header().Get("Content-Type"), w.Body.String())
+	}
+	// Output:
+	// application/vnd.acme.v2+json {"name":"Jane Doe"}
+	// application/json; version=1 {"first":"Jane","last":"Doe"}
+}
+
+func TestParseMediaType(t *testing.T) {
+	tests := []struct {
+		in      string
+		essence string
+		suffix  string
+		version string
+	}{
+		{"application/json", "application/json", "", ""},
+		{"application/json; version=2", "application/json", "", "2"},
+		{"application/vnd.acme.v2+json", "application/vnd.acme.v2+json", "json", "2"},
+		{"application/vnd.acme.v1.1+yaml", "application/vnd.acme.v1.1+yaml", "yaml", "1.1"},
+		{"application/vnd.acme+xml; version=3", "application/vnd.acme+xml", "xml", "3"},
+		{"Application/Vnd.Acme.Video+JSON", "application/vnd.acme.video+json", "json", ""},
+	}
+
+	for _, tt := range tests {
+		m, err := hiccup.ParseMediaType(tt.in)
+		if err != nil {
+			t.Error(tt.in, err)
+			t.FailNow()
+		}
+		if m.Essence() != tt.essence || m.Suffix() != tt.suffix || m.Version() != tt.version {
+			t.Error("unexpected media type", tt.in, m.Essence(), m.Suffix(), m.Version())
+			t.FailNow()
+		}
+	}
+
+	if _, err := hiccup.ParseMediaType("application/"); err == nil {
+		t.Error("expected parse error")
+		t.FailNow()
+	}
+}
+
+func TestHandler_Negotiation(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"version": hiccup.Negotiated(r).Version()})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+		hiccup.WithEncoder("application/json; version=3", func(v any) ([]byte, error) {
+			return []byte(`{"v3":true}`), nil
+		}),
+	)
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"application/vnd.acme.v2+yaml", "application/vnd.acme.v2+yaml", "version: \"2\"\n"},
+		{"application/json; version=2", "application/json; version=2", `{"version":"2"}`},
+		{"application/json; version=3", "application/json; version=3", `{"v3":true}`},
+		{"text/html, application/yaml;q=0.5, application/json;q=0.9", "application/json", `{"version":""}`},
+		{"application/json;q=0, */*", "application/json", `{"version":""}`},
+		{"text/*, application/*", "application/json", `{"version":""}`},
+		{"text/html", "application/json", `{"version":""}`},
+		{"application/vnd.acme.v2+xml", "application/json", `{"version":""}`},
+	}
+
+	for _, tt := range tests {
+		hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept(tt.accept)).
+			Status(http.StatusOK).
+			Header("Content-Type", tt.contentType).
+			Text(tt.body)
+	}
+}
+
+func TestRequestDecoder_MediaType(t *testing.T) {
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+	)
+
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/vnd.acme.v2+yaml", "name: Jane"},
+		{"application/yaml; charset=utf-8", "name: Jane"},
+		{"application/vnd.acme.v2+json", `{"name":"Jane"}`},
+		{"text/plain", `{"name":"Jane"}`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+
+		v := make(map[string]string)
+		if _, err := dec.DecodeBody(req, &v); err != nil || v["name"] != "Jane" {
+			t.Error("unexpected decode", tt.contentType, v, err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package hiccup
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+defaultMethods are allowed in CORS requests to handlers which do not
+describe their methods.
+*/
+var defaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+/*
+Methods maps http methods to the [HandlerFunc] serving them.
+
+See [Resource].
+*/
+type Methods map[string]HandlerFunc
+
+/*
+Resource returns a [ResponseHandler] which serves each method with its own
+[HandlerFunc], sharing the passed [ResponseEncoder] set like a [Handler]
+does. HEAD requests are served by the GET handler unless a HEAD handler is
+set.
+
+Requests of other methods are sent a 405 status code with an "Allow"
+header, and a body encoded by the negotiated encoder.
+*/
+func Resource(m Methods, w ...ResponseEncoder) *ResponseHandler {
+	methods := make(Methods, len(m))
+	for k, v := range m {
+		methods[strings.ToUpper(k)] = v
+	}
+
+	var h *ResponseHandler
+	h = Handler(func(r *http.Request) *Response {
+		fn, ok := methods[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			fn, ok = methods[http.MethodGet]
+		}
+		if !ok {
+			return Respond(http.StatusMethodNotAllowed).
+				SetHeader("Allow", strings.Join(h.methods(), ", ")).
+				SetBody(http.StatusText(http.StatusMethodNotAllowed))
+		}
+		return fn(r)
+	}, w...)
+
+	for _, k := range defaultMethods {
+		if _, ok := methods[k]; ok {
+			h.allowed = append(h.allowed, k)
+		}
+	}
+	var other []string
+	for k := range methods {
+		if !slices.Contains(defaultMethods, k) {
+			other = append(other, k)
+		}
+	}
+	sort.Strings(other)
+	h.allowed = append(h.allowed, other...)
+	return h
+}
+
+/*
+Register adds the handler to a [http.ServeMux] for a path pattern, like
+"/articles/{id}". A method pattern, like "GET /articles/{id}", is registered
+for each known method of the handler, along with the bare path pattern so
+requests of other methods are sent the 405 response of the handler instead
+of the one of the ServeMux. Handlers without known methods are only
+registered for the bare path pattern.
+*/
+func (h *ResponseHandler) Register(mux *http.ServeMux, path string) {
+	for _, m := range h.methods() {
+		mux.Handle(m+" "+path, h)
+	}
+	mux.Handle(path, h)
+}
+
+/*
+SetAutoOptions enables or disables the automatic responses to OPTIONS
+requests, which are enabled by default. Disabled, OPTIONS requests run the
+[HandlerFunc], except for CORS preflight requests.
+
+Automatic responses are only sent by handlers with known methods, which
+are a [Resource] without an OPTIONS method, or a handler with operations
+passed to [ResponseHandler.Describe] and no OPTIONS operation.
+*/
+func (h *ResponseHandler) SetAutoOptions(enabled bool) *ResponseHandler {
+	h.noAutoOptions = !enabled
+	return h
+}
+
+/*
+methods returns the methods allowed by the handler, with "HEAD" added for
+"GET" and "OPTIONS" always included. They are the methods of a [Resource],
+or are read from the operations passed to [ResponseHandler.Describe]. It
+returns nil if the methods are not known.
+*/
+func (h *ResponseHandler) methods() []string {
+	declared := h.allowed
+	if declared == nil {
+		if len(h.operations) == 0 {
+			return nil
+		}
+		for _, op := range h.operations {
+			declared = append(declared, strings.ToUpper(op.Method))
+		}
+	}
+
+	var methods []string
+	add := func(m string) {
+		if !slices.Contains(methods, m) {
+			methods = append(methods, m)
+		}
+	}
+	for _, m := range declared {
+		add(m)
+		if m == http.MethodGet {
+			add(http.MethodHead)
+		}
+	}
+	add(http.MethodOptions)
+	return methods
+}
+
+func (h *ResponseHandler) allows(method string) bool {
+	return slices.Contains(h.methods(), method)
+}
+
+/*
+autoOptions reports whether OPTIONS requests are answered by the handler
+itself, which is if enabled and the methods of the handler are known, unless
+an OPTIONS method is served by a [Resource] or an OPTIONS operation is
+described.
+*/
+func (h *ResponseHandler) autoOptions() bool {
+	if h.noAutoOptions || h.methods() == nil || slices.Contains(h.allowed, http.MethodOptions) {
+		return false
+	}
+	for _, op := range h.operations {
+		if strings.EqualFold(op.Method, http.MethodOptions) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+options returns the automatic response to an OPTIONS request. It sends the
+"Allow" header, and the "Accept-Post" and "Accept-Patch" headers with the
+content types of the request decoder if those methods are allowed.
+*/
+func (h *ResponseHandler) options() *Response {
+	res := Respond(http.StatusNoContent).SetHeader("Allow", strings.Join(h.methods(), ", "))
+	if h.decoder == nil || len(h.decoder.decoders) == 0 {
+		return res
+	}
+
+	types := make([]string, len(h.decoder.decoders))
+	for i, d := range h.decoder.decoders {
+		types[i] = d.ContentType()
+	}
+	if h.allows(http.MethodPost) {
+		res.SetHeader("Accept-Post", strings.Join(types, ", "))
+	}
+	if h.allows(http.MethodPatch) {
+		res.SetHeader("Accept-Patch", strings.Join(types, ", "))
+	}
+	return res
+}
+
+/*
+bodyAllowed reports whether a response status code permits a body.
+*/
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
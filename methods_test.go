@@ -0,0 +1,219 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleResponseHandler_ServeHTTP_options() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusCreated)
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetDecoder(hiccup.Decoder(
+			hiccup.WithDecoder("application/json", json.Unmarshal),
+			hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+		)).
+		Describe(hiccup.Operation{Method: http.MethodGet, Path: "/articles"}).
+		Describe(hiccup.Operation{Method: http.MethodPost, Path: "/articles"})
+
+	w, req := testRequest("OPTIONS", "/articles", nil)
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Code)
+	fmt.Println(w.Header().Get("Allow"))
+	fmt.Println(w.Header().Get("Accept-Post"))
+	// Output:
+	// 204
+	// GET, HEAD, POST, OPTIONS
+	// application/json, application/yaml
+}
+
+func TestHandler_Head(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"msg": "Hello"})
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	get := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Status(http.StatusOK).
+		Header("Content-Length", "15")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("HEAD", "/")).
+		Status(http.StatusOK).
+		ContentType("application/json").
+		Header("Content-Length", strconv.Itoa(len(get.Body))).
+		Text("")
+	if calls != 2 {
+		t.Error("handler not run for HEAD request", calls)
+		t.FailNow()
+	}
+
+	// a response with a known length skips encoding.
+	handler = hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("body").SetHeader("Content-Length", "42")
+	}, hiccup.WithEncoder("application/json", testFailMarshal))
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("HEAD", "/")).
+		Status(http.StatusOK).
+		Header("Content-Length", "42").
+		Text("")
+
+	handler = hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetRaw("text/plain", []byte("raw body"))
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("HEAD", "/")).
+		Status(http.StatusOK).
+		Header("Content-Length", "8").
+		Text("")
+}
+
+func TestHandler_Options(t *testing.T) {
+	called := false
+	myHandler := func(r *http.Request) *hiccup.Response {
+		called = true
+		return hiccup.Respond(http.StatusOK).SetHeader("x-options", "handler")
+	}
+
+	handler := hiccup.Handler(myHandler).
+		SetDecoder(hiccup.Decoder(hiccup.WithDecoder("application/merge-patch+json", json.Unmarshal)))
+	// handlers without known methods serve OPTIONS requests themselves.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusOK).
+		Header("Allow", "").
+		Header("x-options", "handler")
+	if !called {
+		t.Error("handler not called for OPTIONS request")
+		t.FailNow()
+	}
+
+	called = false
+	handler.Describe(hiccup.Operation{Method: "get"})
+	res, header := handler.Invoke(httptestRequest("OPTIONS", "/"))
+	if res.StatusCode != http.StatusNoContent || header.Get("Allow") != "GET, HEAD, OPTIONS" ||
+		header.Get("Accept-Post") != "" || header.Get("Accept-Patch") != "" {
+		t.Error("unexpected options response", res.StatusCode, header)
+		t.FailNow()
+	}
+	if called {
+		t.Error("handler called for OPTIONS request")
+		t.FailNow()
+	}
+
+	handler.Describe(hiccup.Operation{Method: http.MethodPost}, hiccup.Operation{Method: http.MethodPatch})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusNoContent).
+		Header("Allow", "GET, HEAD, POST, PATCH, OPTIONS").
+		Header("Accept-Post", "application/merge-patch+json").
+		Header("Accept-Patch", "application/merge-patch+json")
+
+	handler.SetAutoOptions(false)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusOK).
+		Header("x-options", "handler")
+	if !called {
+		t.Error("handler not called with automatic OPTIONS disabled")
+		t.FailNow()
+	}
+	handler.SetAutoOptions(true)
+
+	called = false
+
+	handler.Describe(hiccup.Operation{Method: http.MethodOptions})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusOK).
+		Header("x-options", "handler")
+	if !called {
+		t.Error("handler not called for described OPTIONS operation")
+		t.FailNow()
+	}
+}
+
+func ExampleResource() {
+	articles := hiccup.Resource(hiccup.Methods{
+		http.MethodGet: func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetBody(map[string]string{"id": r.PathValue("id")})
+		},
+		http.MethodDelete: func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusNoContent)
+		},
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	mux := http.NewServeMux()
+	articles.Register(mux, "/articles/{id}")
+
+	for _, method := range []string{"GET", "PUT"} {
+		w, req := testRequest(method, "/articles/42", nil)
+		mux.ServeHTTP(w, req)
+		fmt.Println(w.Code, w.Header().Get("Allow"), w.Body.String())
+	}
+	// Output:
+	// 200  {"id":"42"}
+	// 405 GET, HEAD, DELETE, OPTIONS "Method Not Allowed"
+}
+
+func TestResource(t *testing.T) {
+	handler := hiccup.Resource(hiccup.Methods{
+		"get": func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetBody("get")
+		},
+		"PURGE": func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetBody("purge")
+		},
+		http.MethodPatch: func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetBody("patch")
+		},
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetDecoder(hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal)))
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Text(`"get"`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("HEAD", "/")).Status(http.StatusOK).Text("")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("PURGE", "/")).Text(`"purge"`)
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("PATCH", "/")).Text(`"patch"`)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("POST", "/").Accept("application/yaml")).
+		Status(http.StatusMethodNotAllowed).
+		ContentType("application/yaml").
+		Header("Allow", "GET, HEAD, PATCH, PURGE, OPTIONS").
+		Text("Method Not Allowed\n")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).
+		Status(http.StatusNoContent).
+		Header("Allow", "GET, HEAD, PATCH, PURGE, OPTIONS").
+		Header("Accept-Patch", "application/json").
+		Header("Accept-Post", "")
+
+	handler = hiccup.Resource(hiccup.Methods{
+		http.MethodOptions: func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetBody("options")
+		},
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("OPTIONS", "/")).Text("options")
+}
+
+func TestResponseHandler_Register(t *testing.T) {
+	mux := http.NewServeMux()
+	hiccup.Resource(hiccup.Methods{
+		http.MethodPost: func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusCreated)
+		},
+	}).Register(mux, "/articles")
+	// other handlers can still be registered for the path with method patterns.
+	mux.Handle("GET /articles", hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("list")
+	}))
+
+	hiccuptest.Do(t, mux, hiccuptest.NewRequest("POST", "/articles")).Status(http.StatusCreated)
+	hiccuptest.Do(t, mux, hiccuptest.NewRequest("GET", "/articles")).Status(http.StatusOK).Text("list")
+	hiccuptest.Do(t, mux, hiccuptest.NewRequest("DELETE", "/articles")).
+		Status(http.StatusMethodNotAllowed).
+		Header("Allow", "POST, OPTIONS")
+}
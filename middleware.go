@@ -0,0 +1,19 @@
+package hiccup
+
+/*
+Middleware wraps a [HandlerFunc] to run code before or after it. Since
+handlers return a structured [Response], a middleware can inspect or modify
+the response of the next handler, or return its own response without
+calling the next handler at all. Responses returned by middleware are
+encoded like any other handler response.
+*/
+type Middleware func(next HandlerFunc) HandlerFunc
+
+/*
+Use adds middleware to the handler. Middleware runs in the order it is
+added, so the first middleware added is the outermost one.
+*/
+func (h *ResponseHandler) Use(m ...Middleware) *ResponseHandler {
+	h.middleware = append(h.middleware, m...)
+	return h
+}
@@ -0,0 +1,60 @@
+package hiccup_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+)
+
+func ExampleResponseHandler_Use() {
+	// a middleware which rejects requests without an api key.
+	requireKey := func(next hiccup.HandlerFunc) hiccup.HandlerFunc {
+		return func(r *http.Request) *hiccup.Response {
+			if r.Header.Get("x-api-key") == "" {
+				return hiccup.Respond(http.StatusUnauthorized).SetBody("missing api key")
+			}
+			return next(r)
+		}
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("Hello World!")
+	}).Use(requireKey)
+
+	w, req := testRequest("GET", "/", nil)
+	handler.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Println(w.Code, string(body))
+	// Output: 401 missing api key
+}
+
+func TestResponseHandler_Use(t *testing.T) {
+	var order []string
+	trace := func(name string) hiccup.Middleware {
+		return func(next hiccup.HandlerFunc) hiccup.HandlerFunc {
+			return func(r *http.Request) *hiccup.Response {
+				order = append(order, name)
+				return next(r).SetHeader("x-"+name, "true")
+			}
+		}
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		order = append(order, "handler")
+		return hiccup.Respond(http.StatusOK)
+	}).Use(trace("first")).Use(trace("second"))
+
+	res, header := handler.Invoke(httptestRequest("GET", "/"))
+	if fmt.Sprint(order) != "[first second handler]" {
+		t.Error("unexpected middleware order", order)
+		t.FailNow()
+	}
+	if res.Headers["x-first"] != "true" || header.Get("x-second") != "true" {
+		t.Error("middleware response headers not set", header)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,115 @@
+package hiccup
+
+import (
+	"context"
+	"net/http"
+)
+
+/*
+Observer receives callbacks around the decode, handle, and encode phases of
+a request, for tracing and metrics.
+
+Start callbacks return the context passed to the matching end callback, so
+an observer can carry span or timing state between them. The context
+returned by HandlerStart is also set on the request passed to the
+[HandlerFunc], so decode callbacks are nested within the handler phase.
+
+Embed [NopObserver] to only implement some of the callbacks. See
+[Telemetry] for a tracing and metrics adapter.
+*/
+type Observer interface {
+	// Called before a request body is decoded by [RequestDecoder.DecodeBody].
+	DecodeStart(ctx context.Context, r *http.Request) context.Context
+	// Called after a request body is decoded.
+	DecodeEnd(ctx context.Context, e DecodeEvent)
+	// Called before the middleware chain and [HandlerFunc] run.
+	HandlerStart(ctx context.Context, r *http.Request) context.Context
+	// Called with the [Response] returned by the handler.
+	HandlerEnd(ctx context.Context, res *Response)
+	// Called once a response encoder is selected for the request.
+	Negotiated(ctx context.Context, e NegotiationEvent)
+	// Called before the response body is encoded.
+	EncodeStart(ctx context.Context) context.Context
+	// Called after the response body is encoded.
+	EncodeEnd(ctx context.Context, e EncodeEvent)
+}
+
+/*
+DecodeEvent describes a finished request body decode.
+*/
+type DecodeEvent struct {
+	// Content type of the decoder used, or "" if none was used.
+	ContentType string
+	// Size of the request body content.
+	Bytes int
+	// Error encountered reading or decoding the body, if any.
+	Err error
+}
+
+/*
+NegotiationEvent describes the response content type selected for a request.
+*/
+type NegotiationEvent struct {
+	// "Accept" header value sent in the request.
+	Accept string
+	// Content type of the selected encoder.
+	ContentType string
+	// No match was made, and the default encoder was selected.
+	Default bool
+}
+
+/*
+EncodeEvent describes a finished response body encode.
+*/
+type EncodeEvent struct {
+	// Content type the body was encoded to.
+	ContentType string
+	// Size of the encoded body content.
+	Bytes int
+	// Error encountered encoding the body, if any.
+	Err error
+}
+
+/*
+NopObserver implements the [Observer] interface with callbacks that do
+nothing. Embed it in an observer type to only implement some callbacks.
+*/
+type NopObserver struct{}
+
+func (NopObserver) DecodeStart(ctx context.Context, r *http.Request) context.Context  { return ctx }
+func (NopObserver) DecodeEnd(ctx context.Context, e DecodeEvent)                      {}
+func (NopObserver) HandlerStart(ctx context.Context, r *http.Request) context.Context { return ctx }
+func (NopObserver) HandlerEnd(ctx context.Context, res *Response)                     {}
+func (NopObserver) Negotiated(ctx context.Context, e NegotiationEvent)                {}
+func (NopObserver) EncodeStart(ctx context.Context) context.Context                   { return ctx }
+func (NopObserver) EncodeEnd(ctx context.Context, e EncodeEvent)                      {}
+
+/*
+SetObserver sets an [Observer] for requests served by the handler. The
+observer is also used by any [RequestDecoder] decoding the request body,
+unless the decoder has its own observer.
+*/
+func (h *ResponseHandler) SetObserver(o Observer) *ResponseHandler {
+	h.observer = o
+	return h
+}
+
+/*
+SetObserver sets an [Observer] for request body decoding. If no observer is
+set, the observer of the [ResponseHandler] serving the request is used.
+*/
+func (r *RequestDecoder) SetObserver(o Observer) *RequestDecoder {
+	r.observer = o
+	return r
+}
+
+type observerKey struct{}
+
+func withObserver(ctx context.Context, o Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, o)
+}
+
+func observerFrom(ctx context.Context) Observer {
+	o, _ := ctx.Value(observerKey{}).(Observer)
+	return o
+}
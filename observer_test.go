@@ -0,0 +1,143 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+)
+
+// recordObserver records the observer callbacks it receives.
+type recordObserver struct {
+	calls []string
+	event []any
+}
+
+func (o *recordObserver) DecodeStart(ctx context.Context, r *http.Request) context.Context {
+	o.calls = append(o.calls, "DecodeStart")
+	return ctx
+}
+
+func (o *recordObserver) DecodeEnd(ctx context.Context, e hiccup.DecodeEvent) {
+	o.calls = append(o.calls, "DecodeEnd")
+	o.event = append(o.event, e)
+}
+
+func (o *recordObserver) HandlerStart(ctx context.Context, r *http.Request) context.Context {
+	o.calls = append(o.calls, "HandlerStart")
+	return ctx
+}
+
+func (o *recordObserver) HandlerEnd(ctx context.Context, res *hiccup.Response) {
+	o.calls = append(o.calls, "HandlerEnd")
+}
+
+func (o *recordObserver) Negotiated(ctx context.Context, e hiccup.NegotiationEvent) {
+	o.calls = append(o.calls, "Negotiated")
+	o.event = append(o.event, e)
+}
+
+func (o *recordObserver) EncodeStart(ctx context.Context) context.Context {
+	o.calls = append(o.calls, "EncodeStart")
+	return ctx
+}
+
+func (o *recordObserver) EncodeEnd(ctx context.Context, e hiccup.EncodeEvent) {
+	o.calls = append(o.calls, "EncodeEnd")
+	o.event = append(o.event, e)
+}
+
+// statusObserver only implements a single callback.
+type statusObserver struct {
+	hiccup.NopObserver
+	status int
+}
+
+func (o *statusObserver) HandlerEnd(ctx context.Context, res *hiccup.Response) {
+	o.status = res.StatusCode
+}
+
+func ExampleResponseHandler_SetObserver() {
+	o := new(statusObserver)
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusAccepted)
+	}).SetObserver(o)
+
+	w, req := testRequest("GET", "/", nil)
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(o.status)
+	// Output: 202
+}
+
+func TestObserver(t *testing.T) {
+	dec := hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal))
+	o := new(recordObserver)
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		var m map[string]string
+		dec.DecodeBody(r, &m)
+		return hiccup.Respond(http.StatusOK).SetBody(m)
+	}, hiccup.WithEncoder("application/json", json.Marshal)).SetObserver(o)
+
+	w, req := testRequest("POST", "/", bytes.NewBufferString(`{"a":"b"}`))
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, req)
+
+	want := "[HandlerStart Negotiated DecodeStart DecodeEnd HandlerEnd EncodeStart EncodeEnd]"
+	if fmt.Sprint(o.calls) != want {
+		t.Error("unexpected observer calls", o.calls)
+		t.FailNow()
+	}
+	if e := o.event[0].(hiccup.NegotiationEvent); e.ContentType != "application/json" || e.Default {
+		t.Error("unexpected negotiation event", e)
+		t.FailNow()
+	}
+	if e := o.event[1].(hiccup.DecodeEvent); e.ContentType != "application/json" || e.Bytes != 9 || e.Err != nil {
+		t.Error("unexpected decode event", e)
+		t.FailNow()
+	}
+	if e := o.event[2].(hiccup.EncodeEvent); e.ContentType != "application/json" || e.Bytes != 9 || e.Err != nil {
+		t.Error("unexpected encode event", e)
+		t.FailNow()
+	}
+
+	// marshal errors are observed, and a decoder observer takes precedence.
+	o = new(recordObserver)
+	do := new(recordObserver)
+	dec.SetObserver(do)
+	handler = hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		dec.DecodeBody(r, new(map[string]string))
+		return hiccup.Respond(http.StatusOK)
+	}, hiccup.WithEncoder("test/failed", testFailMarshal)).SetObserver(o)
+
+	w, req = testRequest("POST", "/", bytes.NewBufferString(`{`))
+	handler.ServeHTTP(w, req)
+	if e := o.event[0].(hiccup.NegotiationEvent); !e.Default {
+		t.Error("expected the default encoder", e)
+		t.FailNow()
+	}
+	if e := o.event[1].(hiccup.EncodeEvent); e.Err == nil {
+		t.Error("expected an encode error", e)
+		t.FailNow()
+	}
+	if len(do.event) != 1 || do.event[0].(hiccup.DecodeEvent).Err == nil {
+		t.Error("expected a decode error", do.event)
+		t.FailNow()
+	}
+
+	// the nop observer does nothing.
+	var nop hiccup.Observer = hiccup.NopObserver{}
+	ctx := context.Background()
+	if nop.DecodeStart(ctx, req) != ctx || nop.HandlerStart(ctx, req) != ctx || nop.EncodeStart(ctx) != ctx {
+		t.Error("expected the passed context")
+		t.FailNow()
+	}
+	nop.DecodeEnd(ctx, hiccup.DecodeEvent{})
+	nop.HandlerEnd(ctx, nil)
+	nop.Negotiated(ctx, hiccup.NegotiationEvent{})
+	nop.EncodeEnd(ctx, hiccup.EncodeEvent{})
+}
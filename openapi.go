@@ -0,0 +1,301 @@
+package hiccup
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenAPI specification version of generated documents.
+const openAPIVersion = "3.1.0"
+
+/*
+Operation describes a single API operation served by a [ResponseHandler],
+for inclusion in an [OpenAPI] document.
+
+Only the Go types of the Request and Responses values are used, so zero
+values work fine:
+
+	hiccup.Operation{
+		Method:    http.MethodPost,
+		Path:      "/articles",
+		Request:   Article{},
+		Responses: map[int]any{http.StatusCreated: Article{}},
+	}
+
+See [ResponseHandler.Describe].
+*/
+type Operation struct {
+	// HTTP method of the operation, like "GET".
+	Method string
+	// Path of the operation. Path parameters use the same "{name}"
+	// syntax as [http.ServeMux] patterns.
+	Path string
+	// Unique identifier of the operation.
+	OperationID string
+	// Short summary of what the operation does.
+	Summary string
+	// Verbose explanation of the operation.
+	Description string
+	// Tags to group the operation with.
+	Tags []string
+	// Request body value, or nil if the operation has no request body.
+	Request any
+	// Response body values keyed by http status code. A nil value
+	// describes a response without a body.
+	Responses map[int]any
+}
+
+/*
+OpenAPI generates an OpenAPI 3.1 document from annotated handlers.
+
+Request body content types are read from the [RequestDecoder] configured
+with [ResponseHandler.SetDecoder], and response content types from the
+handler [ResponseEncoder] set.
+
+See [NewOpenAPI] and [OpenAPI.Serve].
+*/
+type OpenAPI struct {
+	info     OpenAPIInfo
+	handlers []*ResponseHandler
+}
+
+/*
+OpenAPIDocument is the root object of an OpenAPI 3.1 document.
+*/
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi" yaml:"openapi"`
+	Info       OpenAPIInfo                             `json:"info" yaml:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths" yaml:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+/*
+OpenAPIInfo holds the metadata of an OpenAPI document.
+*/
+type OpenAPIInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+/*
+OpenAPIOperation describes a single operation on a path in an OpenAPI
+document.
+*/
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses" yaml:"responses"`
+}
+
+/*
+OpenAPIParameter describes a single operation parameter.
+*/
+type OpenAPIParameter struct {
+	Name     string  `json:"name" yaml:"name"`
+	In       string  `json:"in" yaml:"in"`
+	Required bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+/*
+OpenAPIRequestBody describes the request body of an operation.
+*/
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty" yaml:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content" yaml:"content"`
+}
+
+/*
+OpenAPIResponse describes a single response of an operation.
+*/
+type OpenAPIResponse struct {
+	Description string                       `json:"description" yaml:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+/*
+OpenAPIMediaType describes the body content of a single content type.
+*/
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+/*
+OpenAPIComponents holds the reusable schemas of an OpenAPI document.
+*/
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+}
+
+/*
+NewOpenAPI returns an [OpenAPI] document generator with the passed title
+and API version.
+*/
+func NewOpenAPI(title string, version string) *OpenAPI {
+	return &OpenAPI{
+		info: OpenAPIInfo{
+			Title:   title,
+			Version: version,
+		},
+	}
+}
+
+/*
+Add handlers to the document. Only the operations described with
+[ResponseHandler.Describe] are included.
+*/
+func (o *OpenAPI) Add(h ...*ResponseHandler) *OpenAPI {
+	o.handlers = append(o.handlers, h...)
+	return o
+}
+
+/*
+Document generates the OpenAPI document for all added handlers. Named
+struct types are shared as component schemas.
+*/
+func (o *OpenAPI) Document() *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    o.info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+
+	g := newSchemaGenerator("#/components/schemas/", "json")
+	yg := newSchemaGenerator(g.prefix, "yaml")
+	yg.defs, yg.shared = g.defs, g
+	for _, h := range o.handlers {
+		for _, op := range h.operations {
+			path := openAPIPath(op.Path)
+			item := doc.Paths[path]
+			if item == nil {
+				item = make(map[string]*OpenAPIOperation)
+				doc.Paths[path] = item
+			}
+			item[strings.ToLower(op.Method)] = o.operation(g, yg, h, op)
+		}
+	}
+
+	if len(g.defs) > 0 {
+		doc.Components = &OpenAPIComponents{Schemas: g.defs}
+	}
+	return doc
+}
+
+/*
+contentSchema returns the schema of a body sent as content of the passed
+type, with the json or yaml generator.
+*/
+func contentSchema(g *schemaGenerator, yg *schemaGenerator, contentType string, body any) *Schema {
+	if schemaTag(contentType) == "yaml" {
+		return yg.schema(reflect.TypeOf(body))
+	}
+	return g.schema(reflect.TypeOf(body))
+}
+
+/*
+Serve implements the [HandlerFunc] interface to serve the generated
+document. The document is encoded with the encoders of the handler it
+is served through, so it can be served as json or yaml:
+
+	spec := hiccup.NewOpenAPI("Acme API", "1.0.0").Add(articles, authors)
+	mux.Handle("GET /openapi", hiccup.Handler(spec.Serve, encoders...))
+*/
+func (o *OpenAPI) Serve(r *http.Request) *Response {
+	return Respond(http.StatusOK).SetBody(o.Document())
+}
+
+func (o *OpenAPI) operation(g *schemaGenerator, yg *schemaGenerator, h *ResponseHandler, op Operation) *OpenAPIOperation {
+	out := &OpenAPIOperation{
+		OperationID: op.OperationID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Parameters:  pathParameters(op.Path),
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+
+	if op.Request != nil && h.decoder != nil {
+		content := make(map[string]*OpenAPIMediaType)
+		for _, d := range h.decoder.decoders {
+			content[d.ContentType()] = &OpenAPIMediaType{Schema: contentSchema(g, yg, d.ContentType(), op.Request)}
+		}
+		if len(content) > 0 {
+			out.RequestBody = &OpenAPIRequestBody{Required: true, Content: content}
+		}
+	}
+
+	statuses := make([]int, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	for _, status := range statuses {
+		body := op.Responses[status]
+		res := &OpenAPIResponse{Description: http.StatusText(status)}
+		if body != nil {
+			res.Content = make(map[string]*OpenAPIMediaType)
+			for _, e := range h.encoders {
+				res.Content[e.ContentType()] = &OpenAPIMediaType{Schema: contentSchema(g, yg, e.ContentType(), body)}
+			}
+			if len(h.encoders) == 0 {
+				res.Content[contentTypeText] = &OpenAPIMediaType{Schema: &Schema{Type: "string"}}
+			}
+		}
+		out.Responses[strconv.Itoa(status)] = res
+	}
+	if len(out.Responses) == 0 {
+		out.Responses["default"] = &OpenAPIResponse{Description: "Default response"}
+	}
+	return out
+}
+
+/*
+openAPIPath returns the OpenAPI path template of a [http.ServeMux] style
+path. Wildcards matching the rest of a path, like "{path...}", become
+plain parameters, and the "{$}" end of path anchor is dropped.
+*/
+func openAPIPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		switch {
+		case seg == "{$}":
+			segs[i] = ""
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}"):
+			segs[i] = strings.TrimSuffix(seg, "...}") + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+/*
+pathParameters returns the path parameters of a [http.ServeMux] style
+path, like "/articles/{id}" or "/files/{path...}".
+*/
+func pathParameters(path string) []*OpenAPIParameter {
+	var params []*OpenAPIParameter
+	for _, seg := range strings.Split(path, "/") {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(seg[1:len(seg)-1], "...")
+		if name == "$" || name == "" {
+			continue
+		}
+		params = append(params, &OpenAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	return params
+}
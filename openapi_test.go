@@ -0,0 +1,216 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleOpenAPI() {
+	type Message struct {
+		Text string `json:"text" yaml:"text"`
+	}
+
+	encoders := hiccup.Encoder(
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	)
+
+	// annotate a handler with the operations it serves.
+	hello := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(Message{Text: "Hello World!"})
+	}, encoders...).Describe(hiccup.Operation{
+		Method:    http.MethodGet,
+		Path:      "/hello",
+		Responses: map[int]any{http.StatusOK: Message{}},
+	})
+
+	// serve the document through hiccup as json or yaml.
+	spec := hiccup.NewOpenAPI("Hello API", "1.0.0").Add(hello)
+	mux := http.NewServeMux()
+	mux.Handle("GET /hello", hello)
+	mux.Handle("GET /openapi", hiccup.Handler(spec.Serve, encoders...))
+
+	w, req := testRequest("GET", "/openapi", nil)
+	req.Header.Set("Accept", "application/yaml")
+	mux.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Print(string(body))
+	// Output:
+	// openapi: 3.1.0
+	// info:
+	//     title: Hello API
+	//     version: 1.0.0
+	// paths:
+	//     /hello:
+	//         get:
+	//             responses:
+	//                 "200":
+	//                     description: OK
+	//                     content:
+	//                         application/json:
+	//                             schema:
+	//                                 $ref: '#/components/schemas/Message'
+	//                         application/yaml:
+	//                             schema:
+	//                                 $ref: '#/components/schemas/Message'
+	// components:
+	//     schemas:
+	//         Message:
+	//             type: object
+	//             properties:
+	//                 text:
+	//                     type: string
+}
+
+func TestOpenAPI(t *testing.T) {
+	h := hiccup.Handler(nil, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetDecoder(hiccup.Decoder(
+			hiccup.WithDecoder("application/json", json.Unmarshal),
+			hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+		)).
+		Describe(hiccup.Operation{
+			Method:      http.MethodPut,
+			Path:        "/articles/{id}",
+			OperationID: "putArticle",
+			Tags:        []string{"articles"},
+			Request:     testArticle{},
+			Responses: map[int]any{
+				http.StatusOK:        testArticle{},
+				http.StatusNoContent: nil,
+			},
+		}, hiccup.Operation{
+			Method: http.MethodDelete,
+			Path:   "/articles/{id}",
+		})
+	text := hiccup.Handler(nil).Describe(hiccup.Operation{
+		Method:    http.MethodGet,
+		Path:      "/files/{path...}",
+		Responses: map[int]any{http.StatusOK: ""},
+	})
+
+	doc := hiccup.NewOpenAPI("Test", "1").Add(h, text).Document()
+	if doc.OpenAPI != "3.1.0" {
+		t.Error("unexpected openapi version", doc.OpenAPI)
+		t.FailNow()
+	}
+
+	put := doc.Paths["/articles/{id}"]["put"]
+	if put == nil || put.OperationID != "putArticle" {
+		t.Error("missing put operation")
+		t.FailNow()
+	}
+	if len(put.Parameters) != 1 || put.Parameters[0].Name != "id" || put.Parameters[0].In != "path" {
+		t.Error("missing path parameter", put.Parameters)
+		t.FailNow()
+	}
+	if len(put.RequestBody.Content) != 2 || put.RequestBody.Content["application/yaml"] == nil {
+		t.Error("missing request content types", put.RequestBody.Content)
+		t.FailNow()
+	}
+	if put.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/testArticle" {
+		t.Error("missing response schema")
+		t.FailNow()
+	}
+	if put.Responses["204"].Content != nil {
+		t.Error("unexpected content for empty response")
+		t.FailNow()
+	}
+	if doc.Components.Schemas["testAuthor"] == nil {
+		t.Error("missing nested component schema")
+		t.FailNow()
+	}
+
+	del := doc.Paths["/articles/{id}"]["delete"]
+	if del == nil || del.Responses["default"] == nil || del.RequestBody != nil {
+		t.Error("unexpected delete operation", del)
+		t.FailNow()
+	}
+
+	get := doc.Paths["/files/{path}"]["get"]
+	if get.Parameters[0].Name != "path" {
+		t.Error("unexpected wildcard parameter", get.Parameters[0].Name)
+		t.FailNow()
+	}
+	if get.Responses["200"].Content["text/plain; charset=utf-8"] == nil {
+		t.Error("missing plain text response content", get.Responses["200"].Content)
+		t.FailNow()
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var v map[string]any
+	if err := json.Unmarshal(b, &v); err != nil || v["openapi"] != "3.1.0" {
+		t.Error("invalid json document", err)
+		t.FailNow()
+	}
+}
+
+func TestOpenAPI_Paths(t *testing.T) {
+	h := hiccup.Handler(nil).Describe(
+		hiccup.Operation{Method: http.MethodGet, Path: "/{$}"},
+		hiccup.Operation{Method: http.MethodGet, Path: "/articles/{$}"},
+		hiccup.Operation{Method: http.MethodGet, Path: "/files/{dir}/{path...}"},
+	)
+
+	doc := hiccup.NewOpenAPI("Test", "1").Add(h).Document()
+	for _, path := range []string{"/", "/articles/", "/files/{dir}/{path}"} {
+		if doc.Paths[path]["get"] == nil {
+			t.Error("missing path", path, doc.Paths)
+			t.FailNow()
+		}
+	}
+	params := doc.Paths["/files/{dir}/{path}"]["get"].Parameters
+	if len(params) != 2 || params[1].Name != "path" {
+		t.Error("unexpected path parameters", params)
+		t.FailNow()
+	}
+}
+
+func TestOpenAPI_YamlSchemas(t *testing.T) {
+	type note struct {
+		Text string `json:"text"`
+	}
+	type message struct {
+		Message string
+		Note    note
+	}
+
+	h := hiccup.Handler(nil, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetDecoder(hiccup.Decoder(
+			hiccup.WithDecoder("application/json", json.Unmarshal),
+			hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+		)).
+		Describe(hiccup.Operation{Method: http.MethodPost, Path: "/messages", Request: message{}})
+
+	doc := hiccup.NewOpenAPI("Test", "1").Add(h).Document()
+	content := doc.Paths["/messages"]["post"].RequestBody.Content
+	if content["application/json"].Schema.Ref != "#/components/schemas/message" {
+		t.Error("unexpected json schema", content["application/json"].Schema.Ref)
+		t.FailNow()
+	}
+	if content["application/yaml"].Schema.Ref != "#/components/schemas/message_yaml" {
+		t.Error("unexpected yaml schema", content["application/yaml"].Schema.Ref)
+		t.FailNow()
+	}
+
+	schemas := doc.Components.Schemas
+	if schemas["message"].Properties["Message"] == nil || schemas["message_yaml"].Properties["message"] == nil {
+		t.Error("unexpected field names", schemas)
+		t.FailNow()
+	}
+	// types named the same way for both share a schema.
+	if schemas["message_yaml"].Properties["note"].Ref != "#/components/schemas/note" || schemas["note_yaml"] != nil {
+		t.Error("unexpected nested yaml schema", schemas["message_yaml"].Properties["note"])
+		t.FailNow()
+	}
+}
@@ -0,0 +1,289 @@
+package hiccup
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPage is returned for invalid "limit" or "offset" values.
+	ErrInvalidPage = errors.New("hiccup: invalid page parameters")
+	// ErrInvalidCursor is returned for malformed or tampered cursors.
+	ErrInvalidCursor = errors.New("hiccup: invalid page cursor")
+)
+
+/*
+Paginator parses page parameters from list requests, and builds the links
+between pages.
+
+Clients request a page with the "limit" and "offset" query parameters, or
+with an opaque "cursor" parameter taken from the links of a previous page.
+See [Paginator.Parse] and [NewPage].
+*/
+type Paginator struct {
+	// Page size if no limit is sent. Defaults to 20.
+	DefaultLimit int
+	// Largest page size a client can request. Defaults to 100.
+	MaxLimit int
+	// Key to sign cursors with HMAC-SHA256. Cursors are only encoded if no
+	// key is set, so clients could craft their own.
+	Key []byte
+	// Page links always use cursors, even for pages requested with limit and
+	// offset parameters. Otherwise links use cursors only for pages
+	// requested with a cursor.
+	CursorLinks bool
+	// Header to send the total item count in, like "X-Total-Count". The
+	// header is not sent if empty, or if the total is unknown.
+	TotalCountHeader string
+}
+
+/*
+PageRequest holds the page requested by a client.
+*/
+type PageRequest struct {
+	// Number of items in the page.
+	Limit int
+	// Number of items to skip.
+	Offset int
+	// The page was requested with a cursor, so page links use cursors.
+	Cursor bool
+
+	url       *url.URL
+	paginator *Paginator
+}
+
+/*
+Page is a page of list items, returned as a response body with
+[Page.Respond]. Its fields are encoded like any other response body.
+*/
+type Page[T any] struct {
+	// Items in the page.
+	Items []T `json:"items" yaml:"items"`
+	// Requested page size.
+	Limit int `json:"limit" yaml:"limit"`
+	// Number of items skipped.
+	Offset int `json:"offset" yaml:"offset"`
+	// Total number of items, or nil if unknown.
+	Total *int `json:"total,omitempty" yaml:"total,omitempty"`
+
+	req *PageRequest
+}
+
+type cursor struct {
+	Offset int `json:"o"`
+	Limit  int `json:"l"`
+}
+
+/*
+Parse returns the [PageRequest] sent in the query of a request. A "cursor"
+parameter takes precedence over "limit" and "offset" parameters. Limits
+larger than the maximum are reduced to the maximum.
+
+It returns [ErrInvalidPage] for invalid limit or offset values, and
+[ErrInvalidCursor] for cursors which cannot be decoded or verified.
+*/
+func (p *Paginator) Parse(r *http.Request) (*PageRequest, error) {
+	q := r.URL.Query()
+	req := &PageRequest{
+		Limit:     p.defaultLimit(),
+		url:       r.URL,
+		paginator: p,
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		cur, err := p.decodeCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		req.Limit, req.Offset, req.Cursor = cur.Limit, cur.Offset, true
+	} else {
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: limit %q", ErrInvalidPage, v)
+			}
+			req.Limit = n
+		}
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: offset %q", ErrInvalidPage, v)
+			}
+			req.Offset = n
+		}
+	}
+
+	if req.Limit > p.maxLimit() {
+		req.Limit = p.maxLimit()
+	}
+	return req, nil
+}
+
+func (p *Paginator) defaultLimit() int {
+	if p.DefaultLimit > 0 {
+		return p.DefaultLimit
+	}
+	return 20
+}
+
+func (p *Paginator) maxLimit() int {
+	if p.MaxLimit > 0 {
+		return p.MaxLimit
+	}
+	return 100
+}
+
+/*
+EncodeCursor returns an opaque cursor for a page, signed if a key is set.
+*/
+func (p *Paginator) EncodeCursor(limit int, offset int) string {
+	b, _ := json.Marshal(cursor{Offset: offset, Limit: limit})
+	c := base64.RawURLEncoding.EncodeToString(b)
+	if p.Key == nil {
+		return c
+	}
+	return c + "." + base64.RawURLEncoding.EncodeToString(p.sign(c))
+}
+
+func (p *Paginator) decodeCursor(c string) (*cursor, error) {
+	payload, sig, signed := strings.Cut(c, ".")
+	if p.Key != nil {
+		got, err := base64.RawURLEncoding.DecodeString(sig)
+		if !signed || err != nil || !hmac.Equal(got, p.sign(payload)) {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cur := new(cursor)
+	if err := json.Unmarshal(b, cur); err != nil || cur.Limit < 1 || cur.Offset < 0 {
+		return nil, ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+func (p *Paginator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+/*
+NewPage returns a [Page] of items for a [PageRequest]. Pass the total number
+of items, or a negative total if it is unknown. Without a total, a next page
+is assumed to exist whenever the page is full.
+*/
+func NewPage[T any](req *PageRequest, items []T, total int) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	p := &Page[T]{
+		Items:  items,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+		req:    req,
+	}
+	if total >= 0 {
+		p.Total = &total
+	}
+	return p
+}
+
+/*
+Respond returns a [Response] with the page as body. The RFC 8288 "Link"
+header holds the "first", "prev", "next", and "last" page relations which
+apply, and the total count header is set if configured and the total is
+known.
+*/
+func (p *Page[T]) Respond(statusCode int) *Response {
+	res := Respond(statusCode).SetBody(p)
+	if links := p.Links(); len(links) > 0 {
+		res.SetHeader("Link", strings.Join(links, ", "))
+	}
+	if h := p.req.paginator.TotalCountHeader; h != "" && p.Total != nil {
+		res.SetHeader(h, strconv.Itoa(*p.Total))
+	}
+	return res
+}
+
+func (p *Page[T]) envelope(meta map[string]any) any {
+	meta["limit"] = p.Limit
+	meta["offset"] = p.Offset
+	if p.Total != nil {
+		meta["total"] = *p.Total
+	}
+	return p.Items
+}
+
+func (p *Page[T]) mask(f func(v any) any) any {
+	items := make([]any, len(p.Items))
+	for i, item := range p.Items {
+		items[i] = f(item)
+	}
+	return &Page[any]{Items: items, Limit: p.Limit, Offset: p.Offset, Total: p.Total, req: p.req}
+}
+
+/*
+Links returns the RFC 8288 link values of the page relations which apply.
+*/
+func (p *Page[T]) Links() []string {
+	var links []string
+	link := func(rel string, offset int) {
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", p.req.link(offset), rel))
+	}
+
+	link("first", 0)
+	if p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		link("prev", prev)
+	}
+
+	next := p.Offset + p.Limit
+	if p.Total != nil {
+		if next < *p.Total {
+			link("next", next)
+		}
+		last := 0
+		if *p.Total > 0 {
+			last = (*p.Total - 1) / p.Limit * p.Limit
+		}
+		link("last", last)
+	} else if len(p.Items) >= p.Limit {
+		link("next", next)
+	}
+	return links
+}
+
+/*
+link returns the request URL for the page at the passed offset, keeping any
+other query parameters.
+*/
+func (r *PageRequest) link(offset int) string {
+	q := r.url.Query()
+	q.Del("cursor")
+	q.Del("limit")
+	q.Del("offset")
+	if r.Cursor || r.paginator.CursorLinks {
+		q.Set("cursor", r.paginator.EncodeCursor(r.Limit, offset))
+	} else {
+		q.Set("limit", strconv.Itoa(r.Limit))
+		q.Set("offset", strconv.Itoa(offset))
+	}
+
+	u := url.URL{Path: r.url.Path, RawQuery: q.Encode()}
+	return u.String()
+}
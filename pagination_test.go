@@ -0,0 +1,158 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleNewPage() {
+	paginator := &hiccup.Paginator{TotalCountHeader: "X-Total-Count"}
+	items := []string{"a", "b", "c", "d", "e"}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		page, err := paginator.Parse(r)
+		if err != nil {
+			return hiccup.Respond(http.StatusBadRequest).SetBody(err.Error())
+		}
+
+		end := min(page.Offset+page.Limit, len(items))
+		return hiccup.NewPage(page, items[min(page.Offset, end):end], len(items)).Respond(http.StatusOK)
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	w, req := testRequest("GET", "/letters?limit=2&offset=2", nil)
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Header().Get("X-Total-Count"))
+	fmt.Println(w.Header().Get("Link"))
+	fmt.Println(w.Body.String())
+	// Output:
+	// 5
+	// </letters?limit=2&offset=0>; rel="first", </letters?limit=2&offset=0>; rel="prev", </letters?limit=2&offset=4>; rel="next", </letters?limit=2&offset=4>; rel="last"
+	// {"items":["c","d"],"limit":2,"offset":2,"total":5}
+}
+
+func TestPaginator_Parse(t *testing.T) {
+	p := &hiccup.Paginator{MaxLimit: 50}
+
+	page, err := p.Parse(httptestRequest("GET", "/"))
+	if err != nil || page.Limit != 20 || page.Offset != 0 || page.Cursor {
+		t.Error("unexpected default page", err, page)
+		t.FailNow()
+	}
+
+	page, _ = p.Parse(httptestRequest("GET", "/?limit=500&offset=10"))
+	if page.Limit != 50 || page.Offset != 10 {
+		t.Error("unexpected page", page)
+		t.FailNow()
+	}
+	if page, _ = (&hiccup.Paginator{}).Parse(httptestRequest("GET", "/?limit=500")); page.Limit != 100 {
+		t.Error("unexpected default maximum", page.Limit)
+		t.FailNow()
+	}
+
+	for _, q := range []string{"limit=0", "limit=x", "offset=-1", "offset=x"} {
+		if _, err := p.Parse(httptestRequest("GET", "/?"+q)); !errors.Is(err, hiccup.ErrInvalidPage) {
+			t.Error("expected an invalid page error", q, err)
+			t.FailNow()
+		}
+	}
+
+	page, _ = p.Parse(httptestRequest("GET", "/?cursor="+p.EncodeCursor(5, 15)+"&limit=1"))
+	if page.Limit != 5 || page.Offset != 15 || !page.Cursor {
+		t.Error("unexpected cursor page", page)
+		t.FailNow()
+	}
+
+	signed := &hiccup.Paginator{Key: []byte("secret")}
+	c := signed.EncodeCursor(5, 15)
+	if page, err = signed.Parse(httptestRequest("GET", "/?cursor="+c)); err != nil || page.Offset != 15 {
+		t.Error("unexpected signed cursor page", err, page)
+		t.FailNow()
+	}
+
+	payload, sig, _ := strings.Cut(c, ".")
+	forged := p.EncodeCursor(5, 0) + "." + sig
+	for _, c := range []string{payload, forged, c + "x", payload + ".!"} {
+		if _, err := signed.Parse(httptestRequest("GET", "/?cursor="+c)); !errors.Is(err, hiccup.ErrInvalidCursor) {
+			t.Error("expected an invalid signed cursor error", c, err)
+			t.FailNow()
+		}
+	}
+
+	// e30 is the encoded empty json object.
+	for _, c := range []string{"!", "e30", "bm9wZQ", p.EncodeCursor(0, 0)} {
+		if _, err := p.Parse(httptestRequest("GET", "/?cursor="+c)); !errors.Is(err, hiccup.ErrInvalidCursor) {
+			t.Error("expected an invalid cursor error", c, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPage_Respond(t *testing.T) {
+	p := &hiccup.Paginator{}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		page, _ := p.Parse(r)
+		items := make([]int, 0, page.Limit)
+		for i := page.Offset; i < page.Offset+page.Limit && i < 7; i++ {
+			items = append(items, i)
+		}
+		total := 7
+		if r.URL.Query().Has("unknown") {
+			total = -1
+		}
+		return hiccup.NewPage(page, items, total).Respond(http.StatusOK)
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?limit=3&sort=asc")).
+		Header("Link", `</list?limit=3&offset=0&sort=asc>; rel="first", </list?limit=3&offset=3&sort=asc>; rel="next", </list?limit=3&offset=6&sort=asc>; rel="last"`).
+		Header("X-Total-Count", "").
+		JSONPath("items", []int{0, 1, 2}).
+		JSONPath("total", 7)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?limit=3&offset=1&unknown")).
+		Header("Link", `</list?limit=3&offset=0&unknown=>; rel="first", </list?limit=3&offset=0&unknown=>; rel="prev", </list?limit=3&offset=4&unknown=>; rel="next"`).
+		Text(`{"items":[1,2,3],"limit":3,"offset":1}`)
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?limit=3&offset=6&unknown")).
+		Header("Link", `</list?limit=3&offset=0&unknown=>; rel="first", </list?limit=3&offset=3&unknown=>; rel="prev"`)
+
+	// cursor pages link with cursors.
+	c := p.EncodeCursor(3, 3)
+	res := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?cursor="+c))
+	for _, want := range []string{p.EncodeCursor(3, 0), p.EncodeCursor(3, 6)} {
+		if !strings.Contains(res.Response.Header.Get("Link"), "cursor="+want) {
+			t.Error("missing cursor link", res.Response.Header.Get("Link"))
+			t.FailNow()
+		}
+	}
+
+	// limit and offset pages link with cursors if enabled.
+	p.CursorLinks = true
+	res = hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/list?limit=3&offset=3&sort=asc"))
+	link := res.Response.Header.Get("Link")
+	if !strings.Contains(link, "cursor="+p.EncodeCursor(3, 6)+"&sort=asc") || strings.Contains(link, "offset=") {
+		t.Error("missing cursor link", link)
+		t.FailNow()
+	}
+	p.CursorLinks = false
+
+	page, _ := p.Parse(httptestRequest("GET", "/"))
+	empty := hiccup.NewPage[string](page, nil, 0)
+	if empty.Items == nil || len(empty.Links()) != 2 {
+		t.Error("unexpected empty page", empty.Items, empty.Links())
+		t.FailNow()
+	}
+
+	p.TotalCountHeader = "X-Total-Count"
+	if res := empty.Respond(http.StatusOK); res.Headers["X-Total-Count"] != "0" {
+		t.Error("missing total count header", res.Headers)
+		t.FailNow()
+	}
+}
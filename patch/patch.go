@@ -0,0 +1,487 @@
+/*
+Package patch decodes JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+request bodies for hiccup handlers.
+
+The decoders apply a patch to the value passed to
+[hiccup.RequestDecoder.DecodeBody], which the handler loads before decoding:
+
+	article := loadArticle(r.PathValue("id"))
+	target := &patch.Target{Value: &article}
+	if _, err := decoder.DecodeBody(r, target); err != nil {
+		return hiccup.Respond(http.StatusUnprocessableEntity).SetBody(err.Error())
+	}
+	if target.Changes.State("/title") == patch.Set {
+		...
+	}
+
+Patches are applied to the json encoding of the value, and the result is
+decoded back into it. A patch is applied in full or not at all, so the value
+is left unchanged if any operation fails. Pass a [Target] to learn which
+fields were set, cleared, or left alone by the patch.
+
+Schema validation with [hiccup.RequestDecoder.SetSchemas] validates bodies
+before they are applied, so use a RequestDecoder without schemas for patch
+endpoints, and validate the patched value instead.
+*/
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/afloesch/hiccup"
+)
+
+const (
+	// MergeContentType is the JSON Merge Patch media type.
+	MergeContentType = "application/merge-patch+json"
+	// ContentType is the JSON Patch media type.
+	ContentType = "application/json-patch+json"
+)
+
+var (
+	// ErrTestFailed is returned when a "test" operation does not match.
+	ErrTestFailed = errors.New("patch: test operation failed")
+	// ErrPath is returned for paths which do not exist or cannot be changed.
+	ErrPath = errors.New("patch: invalid path")
+)
+
+/*
+MergeDecoder returns a [hiccup.BodyDecoder] which applies JSON Merge Patch
+documents.
+*/
+func MergeDecoder() hiccup.BodyDecoder {
+	return hiccup.WithDecoder(MergeContentType, MergePatch)
+}
+
+/*
+Decoder returns a [hiccup.BodyDecoder] which applies JSON Patch documents.
+*/
+func Decoder() hiccup.BodyDecoder {
+	return hiccup.WithDecoder(ContentType, JSONPatch)
+}
+
+/*
+State of a field after a patch is applied.
+*/
+type State int
+
+const (
+	// The field was left alone.
+	Unchanged State = iota
+	// The field was set to a new value.
+	Set
+	// The field was removed, or set to null.
+	Cleared
+)
+
+/*
+Changes maps the JSON Pointers (RFC 6901) of the fields changed by a patch,
+like "/author/name", to their [State].
+*/
+type Changes map[string]State
+
+/*
+State returns the state of the field at a JSON Pointer. Fields inside a
+changed object share its state.
+*/
+func (c Changes) State(pointer string) State {
+	for p := pointer; ; {
+		if s, ok := c[p]; ok {
+			return s
+		}
+		i := strings.LastIndexByte(p, '/')
+		if i < 0 {
+			return Unchanged
+		}
+		p = p[:i]
+	}
+}
+
+/*
+Target wraps the value a patch is applied to, and records the fields the
+patch changed.
+*/
+type Target struct {
+	// Pointer to the value to patch.
+	Value any
+	// Fields changed by the patch, set when it is applied.
+	Changes Changes
+}
+
+/*
+MergePatch applies a JSON Merge Patch document to the value v points to,
+or to a [Target].
+*/
+func MergePatch(data []byte, v any) error {
+	var p any
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	return apply(v, func(doc any, changes Changes) (any, error) {
+		return merge(doc, p, "", changes), nil
+	})
+}
+
+func merge(doc any, p any, path string, changes Changes) any {
+	obj, ok := p.(map[string]any)
+	if !ok {
+		changes[path] = Set
+		return p
+	}
+
+	target, ok := doc.(map[string]any)
+	if !ok {
+		target = make(map[string]any)
+		changes[path] = Set
+	}
+	for k, v := range obj {
+		field := path + "/" + escape(k)
+		if v == nil {
+			delete(target, k)
+			changes[field] = Cleared
+			continue
+		}
+		target[k] = merge(target[k], v, field, changes)
+	}
+	return target
+}
+
+/*
+Operation is a single JSON Patch operation.
+*/
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+/*
+OperationError is returned for a JSON Patch operation which cannot be
+applied.
+*/
+type OperationError struct {
+	// Index of the operation in the patch.
+	Index int
+	// The failed operation.
+	Operation Operation
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("patch: operation %d (%s %s): %v", e.Index, e.Operation.Op, e.Operation.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+/*
+JSONPatch applies a JSON Patch document to the value v points to, or to a
+[Target]. It supports the "add", "remove", "replace", "move", "copy" and
+"test" operations. If any operation fails an [OperationError] is returned,
+and the value is not changed.
+*/
+func JSONPatch(data []byte, v any) error {
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return err
+	}
+
+	return apply(v, func(doc any, changes Changes) (any, error) {
+		for i, op := range ops {
+			var err error
+			doc, err = op.apply(doc, changes)
+			if err != nil {
+				return nil, &OperationError{Index: i, Operation: op, Err: err}
+			}
+		}
+		return doc, nil
+	})
+}
+
+func (op Operation) apply(doc any, changes Changes) (any, error) {
+	switch op.Op {
+	case "add", "replace":
+		if op.Op == "replace" {
+			if _, err := get(doc, op.Path); err != nil {
+				return nil, err
+			}
+		}
+		changes[op.Path] = Set
+		return add(doc, op.Path, op.Value, op.Op == "replace")
+	case "remove":
+		changes[op.Path] = Cleared
+		return remove(doc, op.Path)
+	case "copy", "move":
+		v, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move %q into itself", ErrPath, op.From)
+			}
+			if doc, err = remove(doc, op.From); err != nil {
+				return nil, err
+			}
+			changes[op.From] = Cleared
+		} else {
+			v = deepCopy(v)
+		}
+		changes[op.Path] = Set
+		return add(doc, op.Path, v, false)
+	case "test":
+		v, err := get(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("patch: unknown operation %q", op.Op)
+}
+
+/*
+apply decodes the json encoding of a value, patches it with fn, and decodes
+the result back into the value.
+*/
+func apply(v any, fn func(doc any, changes Changes) (any, error)) error {
+	target, ok := v.(*Target)
+	if ok {
+		v = target.Value
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("patch: target must be a non-nil pointer, got %T", v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	changes := make(Changes)
+	if doc, err = fn(doc, changes); err != nil {
+		return err
+	}
+	if b, err = json.Marshal(doc); err != nil {
+		return err
+	}
+
+	// decode into a copy so the value is only changed on success, and keep
+	// fields which are not encoded as json.
+	out := reflect.New(rv.Elem().Type())
+	if out.Elem().Kind() == reflect.Struct {
+		out.Elem().Set(rv.Elem())
+		clearJSONFields(out.Elem())
+	}
+	if err := json.Unmarshal(b, out.Interface()); err != nil {
+		return err
+	}
+	rv.Elem().Set(out.Elem())
+
+	if target != nil {
+		target.Changes = changes
+	}
+	return nil
+}
+
+/*
+clearJSONFields zeroes the struct fields encoded as json, so fields removed
+by a patch are cleared when the result is decoded.
+*/
+func clearJSONFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		v.Field(i).SetZero()
+	}
+}
+
+/*
+tokens splits a JSON Pointer into its unescaped reference tokens.
+*/
+func tokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+	}
+	t := strings.Split(pointer[1:], "/")
+	for i := range t {
+		t[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t[i])
+	}
+	return t, nil
+}
+
+func escape(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func index(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= n || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: index %q", ErrPath, token)
+	}
+	return i, nil
+}
+
+func get(doc any, pointer string) (any, error) {
+	t, err := tokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range t {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+			}
+			doc = v
+		case []any:
+			i, err := index(tok, len(c))
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+		}
+	}
+	return doc, nil
+}
+
+/*
+update calls fn with the container of the last token of a pointer, and
+stores the container it returns in its parent.
+*/
+func update(doc any, pointer string, fn func(container any, token string) (any, error)) (any, error) {
+	t, err := tokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(t) == 0 {
+		return fn(nil, "")
+	}
+	return walk(doc, t, fn)
+}
+
+func walk(doc any, t []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(t) == 1 {
+		return fn(doc, t[0])
+	}
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[t[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: key %q not found", ErrPath, t[0])
+		}
+		v, err := walk(child, t[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[t[0]] = v
+		return c, nil
+	case []any:
+		i, err := index(t[0], len(c))
+		if err != nil {
+			return nil, err
+		}
+		v, err := walk(c[i], t[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %q is not a container", ErrPath, t[0])
+}
+
+func add(doc any, pointer string, value any, replace bool) (any, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	return update(doc, pointer, func(container any, tok string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[tok] = value
+			return c, nil
+		case []any:
+			if tok == "-" && !replace {
+				return append(c, value), nil
+			}
+			n := len(c)
+			if !replace {
+				n++
+			}
+			i, err := index(tok, n)
+			if err != nil {
+				return nil, err
+			}
+			if replace {
+				c[i] = value
+				return c, nil
+			}
+			return append(c[:i], append([]any{value}, c[i:]...)...), nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+	})
+}
+
+func remove(doc any, pointer string) (any, error) {
+	if pointer == "" {
+		return nil, fmt.Errorf("%w: cannot remove the document", ErrPath)
+	}
+	return update(doc, pointer, func(container any, tok string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[tok]; !ok {
+				return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+			}
+			delete(c, tok)
+			return c, nil
+		case []any:
+			i, err := index(tok, len(c))
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrPath, pointer)
+	})
+}
+
+func deepCopy(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(c))
+		for k, v := range c {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []any:
+		s := make([]any, len(c))
+		for i, v := range c {
+			s[i] = deepCopy(v)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,233 @@
+package patch_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/patch"
+)
+
+type author struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type article struct {
+	ID     int      `json:"-"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags,omitempty"`
+	Author *author  `json:"author,omitempty"`
+	views  int
+}
+
+func Example() {
+	decoder := hiccup.Decoder(patch.MergeDecoder(), patch.Decoder())
+
+	a := article{ID: 7, Title: "Draft", Tags: []string{"go"}, Author: &author{Name: "Jane", Email: "jane@example.com"}}
+	req := httptest.NewRequest("PATCH", "/articles/7", bytes.NewBufferString(`{"title":"Hello","author":{"email":null}}`))
+	req.Header.Set("Content-Type", patch.MergeContentType)
+
+	target := &patch.Target{Value: &a}
+	if _, err := decoder.DecodeBody(req, target); err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(a.ID, a.Title, a.Tags, a.Author.Name, a.Author.Email == "")
+	fmt.Println(target.Changes.State("/title") == patch.Set)
+	fmt.Println(target.Changes.State("/author/email") == patch.Cleared)
+	fmt.Println(target.Changes.State("/tags") == patch.Unchanged)
+	// Output:
+	// 7 Hello [go] Jane true
+	// true
+	// true
+	// true
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		// examples from RFC 7396 appendix A.
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var doc, want any
+		mustUnmarshal(t, tt.target, &doc)
+		mustUnmarshal(t, tt.want, &want)
+
+		if err := patch.MergePatch([]byte(tt.patch), &doc); err != nil {
+			t.Error(tt.patch, err)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(doc, want) {
+			t.Error("unexpected merge result", tt.target, tt.patch, doc)
+			t.FailNow()
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`, `{"a":{"b":[1]},"c":{"b":[1,2]}}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`},
+		{`{"foo":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, tt := range tests {
+		var doc, want any
+		mustUnmarshal(t, tt.target, &doc)
+		mustUnmarshal(t, tt.want, &want)
+
+		if err := patch.JSONPatch([]byte(tt.patch), &doc); err != nil {
+			t.Error(tt.patch, err)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(doc, want) {
+			t.Error("unexpected patch result", tt.target, tt.patch, doc)
+			t.FailNow()
+		}
+	}
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	tests := []struct {
+		patch string
+		index int
+		err   error
+	}{
+		{`[{"op":"replace","path":"/title","value":"x"},{"op":"test","path":"/title","value":"y"}]`, 1, patch.ErrTestFailed},
+		{`[{"op":"remove","path":"/missing"}]`, 0, patch.ErrPath},
+		{`[{"op":"replace","path":"/tags/5","value":"x"}]`, 0, patch.ErrPath},
+		{`[{"op":"add","path":"/tags/01","value":"x"}]`, 0, patch.ErrPath},
+		{`[{"op":"add","path":"/missing/deep","value":"x"}]`, 0, patch.ErrPath},
+		{`[{"op":"move","from":"/author","path":"/author/name"}]`, 0, patch.ErrPath},
+		{`[{"op":"add","path":"title","value":"x"}]`, 0, patch.ErrPath},
+	}
+
+	for _, tt := range tests {
+		a := article{Title: "Draft", Tags: []string{"go"}, Author: &author{Name: "Jane"}}
+		err := patch.JSONPatch([]byte(tt.patch), &a)
+
+		var opErr *patch.OperationError
+		if !errors.As(err, &opErr) || opErr.Index != tt.index || !errors.Is(err, tt.err) {
+			t.Error("unexpected error", tt.patch, err)
+			t.FailNow()
+		}
+		// the patch is applied atomically.
+		if a.Title != "Draft" || len(a.Tags) != 1 {
+			t.Error("value changed by failed patch", a)
+			t.FailNow()
+		}
+	}
+
+	if err := patch.JSONPatch([]byte(`[{"op":"frobnicate","path":"/title"}]`), &article{}); err == nil {
+		t.Error("expected unknown operation error")
+		t.FailNow()
+	}
+	if err := patch.MergePatch([]byte(`{}`), article{}); err == nil {
+		t.Error("expected non-pointer target error")
+		t.FailNow()
+	}
+}
+
+func TestTarget_Changes(t *testing.T) {
+	a := article{ID: 1, Title: "Draft", Tags: []string{"go", "http"}, Author: &author{Name: "Jane"}, views: 10}
+	target := &patch.Target{Value: &a}
+
+	err := patch.JSONPatch([]byte(`[
+		{"op":"test","path":"/title","value":"Draft"},
+		{"op":"remove","path":"/tags"},
+		{"op":"replace","path":"/author","value":{"name":"John"}}
+	]`), target)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if a.ID != 1 || a.views != 10 || a.Title != "Draft" || a.Tags != nil || a.Author.Name != "John" {
+		t.Error("unexpected patched value", a)
+		t.FailNow()
+	}
+
+	states := map[string]patch.State{
+		"/title":       patch.Unchanged,
+		"/tags":        patch.Cleared,
+		"/tags/0":      patch.Cleared,
+		"/author":      patch.Set,
+		"/author/name": patch.Set,
+	}
+	for p, want := range states {
+		if got := target.Changes.State(p); got != want {
+			t.Error("unexpected state", p, got)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	decoder := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", func(data []byte, v any) error { return errors.New("json decoder used") }),
+		patch.Decoder(),
+		patch.MergeDecoder(),
+	)
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		a := article{Title: "Draft"}
+		if _, err := decoder.DecodeBody(r, &a); err != nil {
+			return hiccup.Respond(http.StatusUnprocessableEntity).SetBody(err.Error())
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(a.Title)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PATCH", "/", bytes.NewBufferString(`[{"op":"replace","path":"/title","value":"Hello"}]`))
+	req.Header.Set("Content-Type", patch.ContentType)
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "Hello" {
+		t.Error("unexpected response", w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
+
+func mustUnmarshal(t *testing.T, s string, v any) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
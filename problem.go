@@ -0,0 +1,37 @@
+package hiccup
+
+import "net/http"
+
+/*
+Problem is a problem details response body, as defined by RFC 9457. It is
+encoded with the negotiated encoder like any other body.
+
+If request IDs are enabled with [ResponseHandler.SetRequestID], the request
+ID is set on problems sent without one.
+*/
+type Problem struct {
+	// URI reference identifying the problem type.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Short summary of the problem type.
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+	// HTTP status code of the response.
+	Status int `json:"status,omitempty" yaml:"status,omitempty"`
+	// Explanation of this occurrence of the problem.
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	// URI reference identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty" yaml:"instance,omitempty"`
+	// ID of the request the problem occurred in.
+	RequestID string `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+}
+
+/*
+RespondProblem returns a [Response] with a [Problem] body for the status
+code, titled with its status text.
+*/
+func RespondProblem(statusCode int, detail string) *Response {
+	return Respond(statusCode).SetBody(&Problem{
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,42 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleRespondProblem() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.RespondProblem(http.StatusNotFound, "no article with id 7")
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	w, req := testRequest("GET", "/articles/7", nil)
+	handler.ServeHTTP(w, req)
+	fmt.Println(w.Code, w.Body.String())
+	// Output: 404 {"title":"Not Found","status":404,"detail":"no article with id 7"}
+}
+
+func TestProblem(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusConflict).SetBody(hiccup.Problem{
+			Type:     "https://example.com/problems/stale",
+			Title:    "Stale version",
+			Status:   http.StatusConflict,
+			Instance: "/articles/7",
+		})
+	}, hiccup.WithEncoder("application/json", json.Marshal))
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("PUT", "/articles/7")).
+		Status(http.StatusConflict).
+		JSONPath("", map[string]any{
+			"type":     "https://example.com/problems/stale",
+			"title":    "Stale version",
+			"status":   http.StatusConflict,
+			"instance": "/articles/7",
+		})
+}
@@ -0,0 +1,245 @@
+package hiccup
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+RateLimiter configures the [RateLimit] middleware.
+*/
+type RateLimiter struct {
+	// Number of requests allowed per window.
+	Limit int
+	// Window the limit applies to.
+	Window time.Duration
+	// Key returns the key requests are limited by. Requests are limited by
+	// client IP address if nil. Requests with an empty key share one limit.
+	//
+	// See [RateLimitByIP] and [RateLimitByHeader].
+	Key func(r *http.Request) string
+	// Store the limits are kept in. A [TokenBucketStore] is used if nil.
+	Store RateLimitStore
+}
+
+/*
+RateLimitResult is the outcome of taking a request from a limit.
+*/
+type RateLimitResult struct {
+	// The request is within the limit.
+	Allowed bool
+	// Number of requests left in the limit.
+	Remaining int
+	// Time until the full limit is available again.
+	Reset time.Duration
+	// Time until a request is allowed again, if the request is not allowed.
+	RetryAfter time.Duration
+}
+
+/*
+RateLimitStore keeps the state of rate limits. Implementations must be safe
+for concurrent use.
+
+See [NewTokenBucketStore] and [NewSlidingWindowStore].
+*/
+type RateLimitStore interface {
+	// Take counts a request against the limit of a key.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+/*
+RateLimit returns a [Middleware] which limits the number of requests per
+key, with the passed [RateLimiter] settings.
+
+Responses are sent "RateLimit-Limit", "RateLimit-Remaining" and
+"RateLimit-Reset" headers. Requests over the limit are sent a 429 status
+code with a "Retry-After" header, and a body encoded with the negotiated
+encoder, without running the next handler. If the store fails the request
+is allowed, and the error is logged.
+*/
+func RateLimit(l RateLimiter) Middleware {
+	if l.Key == nil {
+		l.Key = RateLimitByIP
+	}
+	if l.Store == nil {
+		l.Store = NewTokenBucketStore()
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r *http.Request) *Response {
+			ctx := r.Context()
+			res, err := l.Store.Take(ctx, l.Key(r), l.Limit, l.Window)
+			if err != nil {
+				logError(ctx, fmt.Errorf("taking rate limit: %w", err))
+				return next(r)
+			}
+
+			var out *Response
+			if res.Allowed {
+				out = next(r)
+			} else {
+				out = Respond(http.StatusTooManyRequests).
+					SetBody("rate limit exceeded").
+					SetHeader("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			}
+			return out.
+				SetHeader("RateLimit-Limit", strconv.Itoa(l.Limit)).
+				SetHeader("RateLimit-Remaining", strconv.Itoa(res.Remaining)).
+				SetHeader("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+/*
+RateLimitByIP returns the IP address of the client sending a request,
+without its port. Forwarding headers are not trusted, so behind a proxy
+use [RateLimitByHeader] with the header set by the proxy instead.
+*/
+func RateLimitByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+/*
+RateLimitByHeader returns a [RateLimiter] key function which limits
+requests by the value of a request header, like an API key.
+*/
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+/*
+TokenBucketStore is an in-memory [RateLimitStore] using token buckets. A
+bucket holds up to limit tokens and is refilled continuously at limit
+tokens per window, so bursts up to the limit are allowed.
+*/
+type TokenBucketStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	idle   time.Time
+}
+
+/*
+NewTokenBucketStore returns an empty [TokenBucketStore].
+*/
+func NewTokenBucketStore() *TokenBucketStore {
+	return &TokenBucketStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *TokenBucketStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > window {
+		// drop buckets which have been full for a window.
+		for k, b := range s.buckets {
+			if now.After(b.idle) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	// tokens refilled per nanosecond.
+	rate := float64(limit) / float64(window)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	res := RateLimitResult{Allowed: b.tokens >= 1}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(limit) - b.tokens) / rate)
+	b.idle = now.Add(res.Reset)
+	return res, nil
+}
+
+/*
+SlidingWindowStore is an in-memory [RateLimitStore] using sliding windows.
+A request is allowed if fewer than limit requests were allowed in the
+window before it, so bursts are limited across window boundaries.
+*/
+type SlidingWindowStore struct {
+	mu      sync.Mutex
+	windows map[string][]time.Time
+	swept   time.Time
+}
+
+/*
+NewSlidingWindowStore returns an empty [SlidingWindowStore].
+*/
+func NewSlidingWindowStore() *SlidingWindowStore {
+	return &SlidingWindowStore{windows: make(map[string][]time.Time)}
+}
+
+func (s *SlidingWindowStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	start := now.Add(-window)
+	if now.Sub(s.swept) > window {
+		for k, times := range s.windows {
+			if !times[len(times)-1].After(start) {
+				delete(s.windows, k)
+			}
+		}
+		s.swept = now
+	}
+
+	// times of the allowed requests in the window, oldest first.
+	times := s.windows[key]
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	times = times[i:]
+
+	res := RateLimitResult{Allowed: len(times) < limit}
+	if res.Allowed {
+		times = append(times, now)
+	} else if len(times) > 0 {
+		res.RetryAfter = times[len(times)-limit].Add(window).Sub(now)
+	}
+	if len(times) > 0 {
+		s.windows[key] = times
+		res.Reset = times[len(times)-1].Add(window).Sub(now)
+	} else {
+		delete(s.windows, key)
+	}
+	res.Remaining = max(limit-len(times), 0)
+	return res, nil
+}
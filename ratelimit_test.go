@@ -0,0 +1,144 @@
+package hiccup_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleRateLimit() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("ok")
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		Use(hiccup.RateLimit(hiccup.RateLimiter{
+			Limit:  2,
+			Window: time.Minute,
+			Key:    hiccup.RateLimitByHeader("X-Api-Key"),
+		}))
+
+	for i := 0; i < 3; i++ {
+		w, req := testRequest("GET", "/", nil)
+		req.Header.Set("X-Api-Key", "key")
+		handler.ServeHTTP(w, req)
+		fmt.Println(w.Code, w.Header().Get("RateLimit-Remaining"), w.Body.String())
+	}
+	// Output:
+	// 200 1 "ok"
+	// 200 0 "ok"
+	// 429 0 "rate limit exceeded"
+}
+
+func TestRateLimit(t *testing.T) {
+	calls := 0
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		calls++
+		return hiccup.Respond(http.StatusOK)
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		Use(hiccup.RateLimit(hiccup.RateLimiter{Limit: 2, Window: time.Minute}))
+
+	from := func(addr string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("GET", "/").RemoteAddr(addr)
+	}
+
+	hiccuptest.Do(t, handler, from("10.0.0.1:1234")).
+		Status(http.StatusOK).
+		Header("RateLimit-Limit", "2").
+		Header("RateLimit-Remaining", "1").
+		Header("RateLimit-Reset", "30")
+	hiccuptest.Do(t, handler, from("10.0.0.1:4321")).
+		Status(http.StatusOK).
+		Header("RateLimit-Remaining", "0")
+	hiccuptest.Do(t, handler, from("10.0.0.1:1234")).
+		Status(http.StatusTooManyRequests).
+		Header("Content-Type", "application/json").
+		Header("Retry-After", "30").
+		Header("RateLimit-Remaining", "0").
+		Header("RateLimit-Reset", "60").
+		Text(`"rate limit exceeded"`)
+
+	// other clients have their own limit.
+	hiccuptest.Do(t, handler, from("10.0.0.2:1234")).Status(http.StatusOK)
+	if calls != 3 {
+		t.Error("handler called", calls, "times, want 3")
+		t.FailNow()
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit int, window time.Duration) (hiccup.RateLimitResult, error) {
+	return hiccup.RateLimitResult{}, fmt.Errorf("store down")
+}
+
+func TestRateLimit_StoreError(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK)
+	}).Use(hiccup.RateLimit(hiccup.RateLimiter{Limit: 1, Window: time.Minute, Store: failingRateLimitStore{}}))
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Status(http.StatusOK).
+		Header("RateLimit-Limit", "")
+}
+
+func TestTokenBucketStore(t *testing.T) {
+	ctx := context.Background()
+	s := hiccup.NewTokenBucketStore()
+	window := 100 * time.Millisecond
+
+	for i := 0; i < 4; i++ {
+		res, _ := s.Take(ctx, "a", 4, window)
+		if !res.Allowed || res.Remaining != 3-i {
+			t.Error("burst request", i, "not allowed", res)
+			t.FailNow()
+		}
+	}
+	res, _ := s.Take(ctx, "a", 4, window)
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > window/4 {
+		t.Error("request over limit allowed", res)
+		t.FailNow()
+	}
+
+	// a token is refilled every quarter window.
+	time.Sleep(window / 4)
+	if res, _ := s.Take(ctx, "a", 4, window); !res.Allowed {
+		t.Error("refilled request not allowed", res)
+		t.FailNow()
+	}
+}
+
+func TestSlidingWindowStore(t *testing.T) {
+	ctx := context.Background()
+	s := hiccup.NewSlidingWindowStore()
+	window := 100 * time.Millisecond
+
+	s.Take(ctx, "a", 2, window)
+	time.Sleep(window / 2)
+	s.Take(ctx, "a", 2, window)
+
+	res, _ := s.Take(ctx, "a", 2, window)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 || res.RetryAfter > window/2 {
+		t.Error("request over limit allowed", res)
+		t.FailNow()
+	}
+	if res, _ := s.Take(ctx, "b", 2, window); !res.Allowed || res.Remaining != 1 {
+		t.Error("request of other key not allowed", res)
+		t.FailNow()
+	}
+
+	// the first request leaves the window, the second does not.
+	time.Sleep(window/2 + 10*time.Millisecond)
+	if res, _ := s.Take(ctx, "a", 2, window); !res.Allowed || res.Remaining != 0 {
+		t.Error("request in window not allowed", res)
+		t.FailNow()
+	}
+	if res, _ := s.Take(ctx, "a", 2, window); res.Allowed {
+		t.Error("request over sliding limit allowed", res)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,121 @@
+package hiccup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+/*
+RawBody is a response body sent as is, bypassing the [ResponseEncoder] of a
+handler. Set it with [Response.SetRaw] or [Response.SetFile].
+
+Content which can seek, like []byte, [bytes.Reader] or most files, supports
+"Range" requests like [fs.File] bodies do. Other content is streamed, with a
+"Content-Length" header if the length is known.
+*/
+type RawBody struct {
+	// Content type to send. If empty it is detected from the file name
+	// extension, or from the content with [http.DetectContentType]. A
+	// "Content-Type" response header takes precedence.
+	ContentType string
+	// Body content, which is an [io.Reader], [io.WriterTo] or []byte.
+	Content any
+
+	fsys fs.FS
+	name string
+}
+
+/*
+contentType returns the content type to send, if known without reading the
+content.
+*/
+func (b *RawBody) contentType() string {
+	if b.ContentType == "" && b.fsys != nil {
+		return mime.TypeByExtension(path.Ext(b.name))
+	}
+	return b.ContentType
+}
+
+/*
+writeRaw sends a raw response body. Errors returned by it are encountered
+before anything is written.
+*/
+func writeRaw(w http.ResponseWriter, r *http.Request, res *Response, b *RawBody) error {
+	body, name := b.Content, ""
+	if b.fsys != nil {
+		f, err := b.fsys.Open(b.name)
+		if err != nil {
+			return err
+		}
+		body, name = f, path.Base(b.name)
+	}
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	header := w.Header()
+	if ct := b.contentType(); ct != "" && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", ct)
+	}
+
+	if v, ok := body.([]byte); ok {
+		body = bytes.NewReader(v)
+	}
+	if rs, ok := body.(io.ReadSeeker); ok {
+		c := &content{ReadSeeker: rs, name: name}
+		if f, ok := rs.(fs.File); ok {
+			if info, err := f.Stat(); err == nil {
+				c.modtime = info.ModTime()
+			}
+		}
+		writeContent(w, r, res, c)
+		return nil
+	}
+
+	switch v := body.(type) {
+	case interface{ Len() int }:
+		header.Set("Content-Length", strconv.Itoa(v.Len()))
+	case fs.File:
+		if info, err := v.Stat(); err == nil && info.Mode().IsRegular() {
+			header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		}
+	}
+
+	var err error
+	switch v := body.(type) {
+	case io.Reader:
+		if header.Get("Content-Type") == "" {
+			br := bufio.NewReaderSize(v, 512)
+			peek, _ := br.Peek(512)
+			header.Set("Content-Type", http.DetectContentType(peek))
+			v = br
+		}
+		w.WriteHeader(res.StatusCode)
+		if r.Method != http.MethodHead {
+			_, err = io.Copy(w, v)
+		}
+	case io.WriterTo:
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		w.WriteHeader(res.StatusCode)
+		if r.Method != http.MethodHead {
+			_, err = v.WriteTo(w)
+		}
+	default:
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		return fmt.Errorf("hiccup: unsupported raw body %T", body)
+	}
+	if err != nil {
+		logError(r.Context(), fmt.Errorf("writing raw body: %w", err))
+	}
+	return nil
+}
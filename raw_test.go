@@ -0,0 +1,117 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleResponse_SetRaw() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetRaw("application/pdf", []byte("%PDF-1.7"))
+	}, hiccup.WithEncoder("application/json", testFailMarshal))
+
+	w, req := testRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(w, req)
+
+	fmt.Println(w.Header().Get("Content-Type"), w.Header().Get("Content-Length"), w.Body.String())
+	// Output: application/pdf 8 %PDF-1.7
+}
+
+type closeReader struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+type writerTo string
+
+func (s writerTo) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+func TestResponse_SetRaw(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n....")
+	reader := &closeReader{Reader: bytes.NewBufferString("<html><body>hi</body></html>")}
+
+	tests := []struct {
+		body        any
+		contentType string
+		wantType    string
+		wantLength  string
+		wantBody    string
+	}{
+		{png, "", "image/png", "12", string(png)},
+		{bytes.NewBufferString("plain text"), "", "text/plain; charset=utf-8", "10", "plain text"},
+		{reader, "", "text/html; charset=utf-8", "", "<html><body>hi</body></html>"},
+		{writerTo("abc"), "", "application/octet-stream", "", "abc"},
+		{writerTo("abc"), "text/csv", "text/csv", "", "abc"},
+	}
+
+	for _, tt := range tests {
+		handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+			return hiccup.Respond(http.StatusOK).SetRaw(tt.contentType, tt.body)
+		})
+		hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+			Status(http.StatusOK).
+			Header("Content-Type", tt.wantType).
+			Header("Content-Length", tt.wantLength).
+			Text(tt.wantBody)
+	}
+	if !reader.closed {
+		t.Error("raw body not closed")
+		t.FailNow()
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetRaw("text/plain", []byte("0123456789"))
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Range", "bytes=-3")).
+		Status(http.StatusPartialContent).
+		Text("789")
+
+	handler = hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetRaw("", struct{}{})
+	})
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Status(http.StatusInternalServerError).
+		ContentType("text/plain")
+}
+
+func TestResponse_SetFile(t *testing.T) {
+	files := fstest.MapFS{
+		"static/app.css": {Data: []byte("body{}")},
+	}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetFile(files, strings.TrimPrefix(r.URL.Path, "/"))
+	})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/static/app.css")).
+		Status(http.StatusOK).
+		ContentType("text/css").
+		Header("Content-Length", "6").
+		Text("body{}")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/static/app.js")).
+		Status(http.StatusNotFound)
+
+	res, header := handler.Invoke(httptestRequest("GET", "/static/app.css"))
+	if _, ok := res.Body.(*hiccup.RawBody); !ok || !strings.HasPrefix(header.Get("Content-Type"), "text/css") {
+		t.Error("unexpected invoke result", res.Body, header)
+		t.FailNow()
+	}
+}
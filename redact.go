@@ -0,0 +1,346 @@
+package hiccup
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultRedactionMask = "[REDACTED]"
+
+// ErrRedaction is returned by [RequestDecoder.DecodeBody] for raw bodies
+// which cannot be redacted.
+var ErrRedaction = errors.New("hiccup: body cannot be redacted")
+
+/*
+Redaction replaces the values of sensitive struct fields with a mask.
+
+Fields are sensitive if tagged `hiccup:"sensitive"`. Roles allowed to see a
+field follow the "sensitive" option, like `hiccup:"sensitive,admin,billing"`,
+and the field is only sent as is to principals with one of them. Fields of
+nested structs, and of structs in maps, slices and interface values, are
+redacted as well. Redacted fields are always sent as the mask string,
+whatever their type and value. Values of types with their own marshaler for
+the negotiated encoder, like a MarshalJSON method, are redacted in the value
+they marshal to, matching fields by name.
+
+See [ResponseHandler.SetRedaction] and [RequestDecoder.SetRedaction].
+*/
+type Redaction struct {
+	// Roles returns the roles of the [Principal] of a request. Sensitive
+	// fields are redacted for every request if nil.
+	Roles func(principal any) []string
+	// Value redacted fields are replaced with. Defaults to "[REDACTED]".
+	Mask string
+}
+
+/*
+SetRedaction redacts the sensitive fields of response bodies with the
+passed [Redaction] rules before they are encoded, for responses of every
+status code. Passing nil disables it. Raw and file bodies are sent as is.
+*/
+func (h *ResponseHandler) SetRedaction(red *Redaction) *ResponseHandler {
+	h.redaction = red
+	return h
+}
+
+/*
+redact returns the response with the sensitive fields of its body redacted
+for the principal of the request.
+*/
+func (h *ResponseHandler) redact(r *http.Request, res *Response) *Response {
+	if h.redaction == nil || res.Body == nil {
+		return res
+	}
+	if _, ok := res.Body.(*RawBody); ok || isContent(res.Body) {
+		return res
+	}
+
+	var roles []string
+	if h.redaction.Roles != nil {
+		if p := Principal(r); p != nil {
+			roles = h.redaction.Roles(p)
+		}
+	}
+	rv := &redactor{
+		Redaction: h.redaction,
+		roles:     roles,
+		tag:       schemaTag(Negotiated(r).String()),
+		seen:      make(map[visit]bool),
+	}
+	v, changed := rv.value(reflect.ValueOf(res.Body))
+	if !changed {
+		return res
+	}
+	cp := *res
+	cp.Body = v.Interface()
+	return &cp
+}
+
+func (red *Redaction) mask() string {
+	if red.Mask == "" {
+		return defaultRedactionMask
+	}
+	return red.Mask
+}
+
+/*
+sensitive reports whether a struct field is sensitive for principals with
+the passed roles.
+*/
+func sensitive(sf reflect.StructField, roles []string) bool {
+	opts := strings.Split(sf.Tag.Get("hiccup"), ",")
+	if opts[0] != "sensitive" {
+		return false
+	}
+	for _, role := range opts[1:] {
+		if slices.Contains(roles, strings.TrimSpace(role)) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+redactor redacts a single value for the principal of a request.
+*/
+type redactor struct {
+	*Redaction
+	// Roles of the principal.
+	roles []string
+	// Schema tag of the negotiated encoder.
+	tag string
+	// Pointers, maps and slices being redacted, to stop at cycles.
+	seen map[visit]bool
+}
+
+/*
+visit identifies a pointer, map or slice value.
+*/
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+/*
+value returns a copy of v with its sensitive fields redacted, and whether
+any field was redacted. Values without sensitive fields are returned as is,
+and values referencing themselves are not redacted again.
+*/
+func (red *redactor) value(v reflect.Value) (reflect.Value, bool) {
+	if out, ok := marshaled(v, red.tag); ok && v.Kind() != reflect.Interface {
+		if out, changed := red.raw(out, v.Type(), red.roles, red.tag); changed {
+			return reflect.ValueOf(out), true
+		}
+		return v, false
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return v, false
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if red.seen[key] {
+			return v, false
+		}
+		red.seen[key] = true
+		defer delete(red.seen, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		if e, changed := red.value(v.Elem()); changed {
+			return e, true
+		}
+	case reflect.Struct:
+		var fields []structField
+		var values []reflect.Value
+		var changed bool
+		for _, f := range structFields(v.Type(), red.tag) {
+			fv, err := v.FieldByIndexErr(f.Index)
+			if err != nil {
+				// a promoted field of a nil embedded pointer is not encoded.
+				continue
+			}
+			if sensitive(f.Field, red.roles) {
+				f.Field.Tag = withoutStringOption(f.Field.Tag)
+				fv, changed = reflect.ValueOf(red.mask()), true
+			} else if nv, ok := red.value(fv); ok {
+				fv, changed = nv, true
+			}
+			fields = append(fields, f)
+			values = append(values, fv)
+		}
+		if changed {
+			return newStruct(fields, values), true
+		}
+	case reflect.Map:
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			ev, changed := red.value(iter.Value())
+			if changed && !out.IsValid() {
+				// copy the map to a map with values of any type.
+				out = reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), reflect.TypeFor[any]()), v.Len())
+				for _, k := range v.MapKeys() {
+					out.SetMapIndex(k, v.MapIndex(k))
+				}
+			}
+			if changed {
+				out.SetMapIndex(iter.Key(), ev)
+			}
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	case reflect.Slice, reflect.Array:
+		var out []any
+		for i := 0; i < v.Len(); i++ {
+			ev, changed := red.value(v.Index(i))
+			if changed && out == nil {
+				out = make([]any, v.Len())
+				for j := range out {
+					out[j] = v.Index(j).Interface()
+				}
+			}
+			if changed {
+				out[i] = ev.Interface()
+			}
+		}
+		if out != nil {
+			return reflect.ValueOf(out), true
+		}
+	}
+	return v, false
+}
+
+/*
+withoutStringOption returns a struct tag without the "string" option of its
+json tag, so masks replacing the value are not quoted again.
+*/
+func withoutStringOption(tag reflect.StructTag) reflect.StructTag {
+	v, ok := tag.Lookup("json")
+	if !ok {
+		return tag
+	}
+	opts := strings.Split(v, ",")
+	out := opts[:1]
+	for _, opt := range opts[1:] {
+		if opt != "string" {
+			out = append(out, opt)
+		}
+	}
+	old := "json:" + strconv.Quote(v)
+	return reflect.StructTag(strings.Replace(string(tag), old, "json:"+strconv.Quote(strings.Join(out, ",")), 1))
+}
+
+/*
+SetRedaction redacts the sensitive fields of the raw body bytes returned by
+DecodeBody with the passed [Redaction] rules, for every principal, so raw
+bodies can be logged. The value passed to DecodeBody is decoded as is. The
+redacted body is encoded again with the passed [ResponseEncoder] matching
+the content type of the body. If there is none, or if the body cannot be
+decoded, no raw bytes are returned, and DecodeBody returns an error wrapping
+[ErrRedaction]. Passing nil disables it.
+*/
+func (r *RequestDecoder) SetRedaction(red *Redaction, enc ...ResponseEncoder) *RequestDecoder {
+	r.redaction = red
+	r.redactionEncoders = enc
+	return r
+}
+
+/*
+redactRaw returns the raw body decoded with the decoder of the content
+type, with the sensitive fields of the type of v redacted.
+*/
+func (r *RequestDecoder) redactRaw(contentType string, b []byte, v any) ([]byte, error) {
+	if contentType == "" {
+		return nil, fmt.Errorf("%w: no decoder", ErrRedaction)
+	}
+	var enc ResponseEncoder
+	for _, e := range r.redactionEncoders {
+		if mediaTypeOf(e.ContentType()).Essence() == mediaTypeOf(contentType).Essence() {
+			enc = e
+			break
+		}
+	}
+	i := matchMediaType(r.types, mediaTypeOf(contentType))
+	if enc == nil || i < 0 {
+		return nil, fmt.Errorf("%w: no encoder for %q", ErrRedaction, contentType)
+	}
+
+	var raw any
+	if err := r.decoders[i].Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRedaction, err)
+	}
+	redacted, _ := r.redaction.raw(raw, reflect.TypeOf(v), nil, schemaTag(contentType))
+	out, err := enc.Marshal(redacted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRedaction, err)
+	}
+	return out, nil
+}
+
+/*
+raw redacts the sensitive fields of the passed type for principals with the
+passed roles in a generic decoded value, matching fields by the names of the
+passed struct tag, and reports whether any field was redacted.
+*/
+func (red *Redaction) raw(v any, t reflect.Type, roles []string, tag string) (any, bool) {
+	if t == nil {
+		return v, false
+	}
+	var changed bool
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v, false
+		}
+		for _, f := range structFields(t, tag) {
+			fv, ok := m[f.Name]
+			if !ok {
+				continue
+			}
+			redacted := sensitive(f.Field, roles)
+			if redacted {
+				m[f.Name] = red.mask()
+			} else {
+				m[f.Name], redacted = red.raw(fv, f.Type, roles, tag)
+			}
+			changed = changed || redacted
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]any); ok {
+			for k, ev := range m {
+				var ok bool
+				m[k], ok = red.raw(ev, t.Elem(), roles, tag)
+				changed = changed || ok
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]any); ok {
+			for i, ev := range s {
+				var ok bool
+				s[i], ok = red.raw(ev, t.Elem(), roles, tag)
+				changed = changed || ok
+			}
+		}
+	}
+	return v, changed
+}
@@ -0,0 +1,237 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+	"go.yaml.in/yaml/v3"
+)
+
+type card struct {
+	Number string `json:"number" yaml:"number" hiccup:"sensitive,billing"`
+	Expiry string `json:"expiry" yaml:"expiry"`
+}
+
+type account struct {
+	ID       int     `json:"id" yaml:"id"`
+	Email    string  `json:"email" yaml:"email"`
+	Password string  `json:"password,omitempty" yaml:"password,omitempty" hiccup:"sensitive"`
+	PIN      int     `json:"pin" yaml:"pin" hiccup:"sensitive"`
+	Cards    []card  `json:"cards,omitempty" yaml:"cards,omitempty"`
+	Primary  *card   `json:"primary,omitempty" yaml:"primary,omitempty"`
+	Extra    any     `json:"extra,omitempty" yaml:"extra,omitempty"`
+	Balance  float64 `json:"balance" yaml:"balance"`
+}
+
+func ExampleResponseHandler_SetRedaction() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(account{ID: 1, Email: "ada@example.com", Password: "hunter2", PIN: 1234})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetRedaction(&hiccup.Redaction{})
+
+	w, req := testRequest("GET", "/accounts/1", nil)
+	handler.ServeHTTP(w, req)
+	fmt.Println(w.Body.String())
+	// Output: {"id":1,"email":"ada@example.com","password":"[REDACTED]","pin":"[REDACTED]","balance":0}
+}
+
+func TestResponseHandler_SetRedaction(t *testing.T) {
+	acct := account{
+		ID:      1,
+		Email:   "ada@example.com",
+		PIN:     1234,
+		Cards:   []card{{Number: "4111", Expiry: "12/30"}},
+		Primary: &card{Number: "4222", Expiry: "01/31"},
+		Extra:   map[string]any{"backup": card{Number: "4333"}},
+	}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Path == "/plain" {
+			return hiccup.Respond(http.StatusOK).SetBody(card{Expiry: "12/30"}.Expiry)
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(&acct)
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetAuth(&hiccup.Auth{
+		Authenticators: []hiccup.Authenticator{
+			hiccup.BearerAuth("api", func(ctx context.Context, token string) (any, error) {
+				return token, nil
+			}),
+		},
+		Optional: true,
+	}).SetRedaction(&hiccup.Redaction{
+		Roles: func(principal any) []string { return []string{principal.(string)} },
+		Mask:  "***",
+	}).SetFieldMask(&hiccup.FieldMask{})
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		JSONPath("", map[string]any{
+			"id":       1,
+			"email":    "ada@example.com",
+			"password": "***",
+			"pin":      "***",
+			"cards":    []any{map[string]any{"number": "***", "expiry": "12/30"}},
+			"primary":  map[string]any{"number": "***", "expiry": "01/31"},
+			"extra":    map[string]any{"backup": map[string]any{"number": "***", "expiry": ""}},
+			"balance":  0,
+		})
+
+	// principals with an allowed role are sent the field.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("Authorization", "Bearer billing")).
+		JSONPath("cards.0.number", "4111").
+		JSONPath("primary.number", "4222").
+		JSONPath("pin", "***")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/?fields=pin,primary.number").Accept("application/yaml")).
+		Text("pin: '***'\nprimary:\n    number: '***'\n")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/plain")).Text(`"12/30"`)
+
+	if acct.PIN != 1234 || acct.Cards[0].Number != "4111" {
+		t.Error("response body modified", acct)
+		t.FailNow()
+	}
+}
+
+// secret marshals its fields under other names.
+type secret struct {
+	Key   string `json:"key" hiccup:"sensitive"`
+	Owner string `json:"owner"`
+}
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"key": s.Key, "owner": s.Owner, "kind": "secret"})
+}
+
+// node references other nodes, and can reference itself.
+type node struct {
+	Name  string  `json:"name"`
+	Token string  `json:"token" hiccup:"sensitive"`
+	Links []*node `json:"links,omitempty"`
+}
+
+func TestRedaction_Values(t *testing.T) {
+	type stamped struct {
+		Signed  time.Time `json:"signed"`
+		Secret  secret    `json:"secret"`
+		Counter int       `json:"counter,string" hiccup:"sensitive"`
+	}
+	loop := &node{Name: "a", Token: "t"}
+	loop.Links = []*node{loop}
+
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		if r.URL.Path == "/loop" {
+			return hiccup.Respond(http.StatusOK).SetBody(loop)
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(stamped{
+			Signed:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Secret:  secret{Key: "k", Owner: "ada"},
+			Counter: 7,
+		})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetRedaction(&hiccup.Redaction{})
+
+	// marshalers are kept, and sensitive fields of their values redacted.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Text(`{"signed":"2024-01-01T00:00:00Z","secret":{"key":"[REDACTED]","kind":"secret","owner":"ada"},"counter":"[REDACTED]"}`)
+
+	// cycles are left to the encoder to report.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/loop")).
+		Status(http.StatusInternalServerError)
+}
+
+func TestRedaction_Yaml(t *testing.T) {
+	type Base struct {
+		Password string `json:"password" yaml:"password" hiccup:"sensitive"`
+	}
+	type user struct {
+		Base
+		Name  string `json:"name" yaml:"name"`
+		Token string `json:"-" yaml:"token" hiccup:"sensitive"`
+	}
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(user{Base: Base{Password: "p"}, Name: "a", Token: "secret"})
+	},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	).SetRedaction(&hiccup.Redaction{})
+
+	// fields are matched by the names of the negotiated encoder.
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Accept("application/yaml")).
+		Text("base:\n    password: '[REDACTED]'\nname: a\ntoken: '[REDACTED]'\n")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).
+		Text(`{"password":"[REDACTED]","name":"a"}`)
+}
+
+func TestResponseHandler_InvokeRedaction(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody(card{Number: "4111", Expiry: "12/30"})
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetRedaction(&hiccup.Redaction{}).
+		SetFieldMask(&hiccup.FieldMask{Header: "X-Fields"})
+
+	req := httptestRequest("GET", "/")
+	req.Header.Set("X-Fields", "number")
+	res, header := handler.Invoke(req)
+	b, err := json.Marshal(res.Body)
+	if err != nil || string(b) != `{"number":"[REDACTED]"}` {
+		t.Error("unexpected invoked body", err, string(b))
+		t.FailNow()
+	}
+	if header.Get("Vary") != "Accept, X-Fields" {
+		t.Error("unexpected Vary header", header.Values("Vary"))
+		t.FailNow()
+	}
+}
+
+func TestRequestDecoder_SetRedaction(t *testing.T) {
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+		hiccup.WithDecoder("text/csv", json.Unmarshal),
+	).SetRedaction(&hiccup.Redaction{},
+		hiccup.WithEncoder("application/json", json.Marshal),
+		hiccup.WithEncoder("application/yaml", yaml.Marshal),
+	)
+
+	var a account
+	_, req := testRequest("POST", "/", bytes.NewBufferString(`{"email":"ada@example.com","password":"hunter2","cards":[{"number":"4111"}]}`))
+	b, err := dec.DecodeBody(req, &a)
+	if err != nil || a.Password != "hunter2" || a.Cards[0].Number != "4111" {
+		t.Error("unexpected decoded value", err, a)
+		t.FailNow()
+	}
+	if string(b) != `{"cards":[{"number":"[REDACTED]"}],"email":"ada@example.com","password":"[REDACTED]"}` {
+		t.Error("unexpected raw body", string(b))
+		t.FailNow()
+	}
+
+	a = account{}
+	_, req = testRequest("POST", "/", bytes.NewBufferString("pin: 1234\nid: 7\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	b, err = dec.DecodeBody(req, &a)
+	if err != nil || a.PIN != 1234 || string(b) != "id: 7\npin: '[REDACTED]'\n" {
+		t.Error("unexpected yaml raw body", err, string(b))
+		t.FailNow()
+	}
+
+	// bodies which cannot be redacted are not returned, and fail.
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"pin": 1234`))
+	if b, err := dec.DecodeBody(req, &a); err == nil || b != nil {
+		t.Error("invalid raw body returned", err, string(b))
+		t.FailNow()
+	}
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"pin": 1234}`))
+	req.Header.Set("Content-Type", "text/csv")
+	if b, err := dec.DecodeBody(req, &a); !errors.Is(err, hiccup.ErrRedaction) || b != nil {
+		t.Error("raw body without an encoder returned", err, string(b))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,149 @@
+package hiccup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+SetRequestID enables request IDs, read from and echoed in the passed
+request header, like "X-Request-ID". Passing an empty string disables them.
+
+The ID sent in the header is used if it is valid, or else the trace ID of a
+W3C "traceparent" header, or else a random ID is generated. The ID is
+available to handlers with [RequestID], is sent in the response header, is
+included in log records, and is added to 5XX plain text error bodies and
+[Problem] bodies.
+*/
+func (h *ResponseHandler) SetRequestID(header string) *ResponseHandler {
+	h.requestID = http.CanonicalHeaderKey(header)
+	return h
+}
+
+type requestIDKey struct{}
+
+/*
+RequestID returns the ID of a request, or an empty string if request IDs
+are not enabled.
+*/
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+/*
+withRequestID returns the request with its ID in the context.
+*/
+func (h *ResponseHandler) withRequestID(r *http.Request) *http.Request {
+	id := r.Header.Get(h.requestID)
+	if !validRequestID(id) {
+		id = traceID(r.Header.Get("traceparent"))
+	}
+	if id == "" {
+		id = newRequestID(r.Context())
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// Sequence of the request IDs generated without a random source.
+var requestIDSeq atomic.Uint64
+
+/*
+newRequestID returns a random request ID. If the random source fails, the
+error is logged and the ID is built from the current time and a sequence
+number instead, so IDs stay unique.
+*/
+func newRequestID(ctx context.Context) string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		logError(ctx, fmt.Errorf("generating request id: %w", err))
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + "-" + strconv.FormatUint(requestIDSeq.Add(1), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+/*
+validRequestID reports whether a request ID sent by a client is safe to
+echo and log.
+*/
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+traceID returns the trace ID of a "traceparent" header value, or an empty
+string if it is invalid.
+*/
+func traceID(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	id := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+/*
+withRequestIDBody returns the response with the request ID set on a
+[Problem] body sent without one.
+*/
+func withRequestIDBody(r *http.Request, res *Response) *Response {
+	id := RequestID(r)
+	if id == "" {
+		return res
+	}
+	var p Problem
+	switch b := res.Body.(type) {
+	case *Problem:
+		if b == nil || b.RequestID != "" {
+			return res
+		}
+		p = *b
+	case Problem:
+		if b.RequestID != "" {
+			return res
+		}
+		p = b
+	default:
+		return res
+	}
+	p.RequestID = id
+	cp := *res
+	cp.Body = &p
+	return &cp
+}
+
+/*
+errorText returns a plain text error body, with the request ID if there is
+one.
+*/
+func errorText(r *http.Request, msg string) string {
+	// the ID is not escaped, since IDs sent by clients only hold the
+	// characters allowed by validRequestID, and others are generated.
+	if id := RequestID(r); id != "" {
+		return msg + " (request id " + id + ")"
+	}
+	return msg
+}
@@ -0,0 +1,132 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+	"github.com/afloesch/hiccup/hiccuptest"
+)
+
+func ExampleResponseHandler_SetRequestID() {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.RespondProblem(http.StatusBadRequest, "missing title")
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetRequestID("X-Request-ID")
+
+	w, req := testRequest("POST", "/articles", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	handler.ServeHTTP(w, req)
+	fmt.Println(w.Header().Get("X-Request-ID"), w.Body.String())
+	// Output: req-42 {"title":"Bad Request","status":400,"detail":"missing title","request_id":"req-42"}
+}
+
+func TestResponseHandler_SetRequestID(t *testing.T) {
+	var seen string
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		seen = hiccup.RequestID(r)
+		switch r.URL.Path {
+		case "/fail":
+			return hiccup.Respond(http.StatusOK).SetBody(func() {})
+		case "/problem":
+			return hiccup.Respond(http.StatusConflict).SetBody(&hiccup.Problem{Status: http.StatusConflict, RequestID: "own"})
+		}
+		return hiccup.Respond(http.StatusOK).SetBody("ok")
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetRequestID("x-request-id")
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("X-Request-ID", "abc-1")).
+		Header("X-Request-ID", "abc-1")
+	if seen != "abc-1" {
+		t.Error("handler request id is", seen)
+		t.FailNow()
+	}
+
+	// trace ids are used for requests without a valid request id.
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").
+		Header("X-Request-ID", "bad id\r\n").
+		Header("traceparent", traceparent)).
+		Header("X-Request-ID", "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	res := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/").Header("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"))
+	generated := res.Response.Header.Get("X-Request-ID")
+	if !regexp.MustCompile("^[0-9a-f]{32}$").MatchString(generated) || generated != seen {
+		t.Error("generated request id is", generated)
+		t.FailNow()
+	}
+
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/fail").Header("X-Request-ID", "abc-2")).
+		Status(http.StatusInternalServerError).
+		Header("X-Request-ID", "abc-2").
+		Text("json: unsupported type: func() (request id abc-2)")
+	hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/problem").Header("X-Request-ID", "abc-3")).
+		JSONPath("request_id", "own")
+
+	_, header := handler.Invoke(httptestRequest("GET", "/"))
+	if header.Get("X-Request-ID") == "" || header.Get("X-Request-ID") != seen {
+		t.Error("invoke request id is", header.Get("X-Request-ID"), seen)
+		t.FailNow()
+	}
+}
+
+// failReader fails every read.
+type failReader struct{}
+
+func (failReader) Read(p []byte) (int, error) {
+	return 0, errors.New("entropy exhausted")
+}
+
+func TestRequestID_RandomFailure(t *testing.T) {
+	reader := rand.Reader
+	rand.Reader = failReader{}
+	defer func() { rand.Reader = reader }()
+
+	var buf bytes.Buffer
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("ok")
+	}).SetRequestID("X-Request-ID").SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	first := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Response.Header.Get("X-Request-ID")
+	second := hiccuptest.Do(t, handler, hiccuptest.NewRequest("GET", "/")).Response.Header.Get("X-Request-ID")
+	if first == "" || first == second || first == strings.Repeat("0", 32) {
+		t.Error("unexpected fallback request ids", first, second)
+		t.FailNow()
+	}
+	if !strings.Contains(buf.String(), "generating request id: entropy exhausted") {
+		t.Error("random source error not logged", buf.String())
+		t.FailNow()
+	}
+}
+
+func TestRequestID_Replay(t *testing.T) {
+	var buf bytes.Buffer
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusCreated).SetBody("created")
+	}).SetRequestID("X-Request-ID").
+		SetIdempotency(hiccup.NewMemoryIdempotencyStore(time.Minute)).
+		SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	post := func(id string) *hiccuptest.Request {
+		return hiccuptest.NewRequest("POST", "/").Header("Idempotency-Key", "k").Header("X-Request-ID", id)
+	}
+	hiccuptest.Do(t, handler, post("first")).Header("X-Request-ID", "first")
+	hiccuptest.Do(t, handler, post("second")).
+		Header("Idempotent-Replayed", "true").
+		Header("X-Request-ID", "second")
+
+	records := logRecords(t, &buf)
+	if len(records) != 2 || records[1]["request_id"] != "second" {
+		t.Error("request id not logged", records)
+		t.FailNow()
+	}
+}
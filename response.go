@@ -1,6 +1,9 @@
 package hiccup
 
-import "net/http"
+import (
+	"io/fs"
+	"net/http"
+)
 
 /*
 ResponseEncoder defines an interface to describe different marshalers
@@ -15,6 +18,28 @@ type ResponseEncoder interface {
 	Marshal(v any) ([]byte, error)
 }
 
+/*
+RequestMarshaler is an optional interface a [ResponseEncoder] can implement
+to encode response body content based on the request being served, like an
+encoder supporting sparse fieldsets sent as query parameters. If implemented,
+MarshalRequest is used instead of Marshal, and the status code of the
+response is available from the request with [ResponseStatus].
+*/
+type RequestMarshaler interface {
+	MarshalRequest(r *http.Request, v any) ([]byte, error)
+}
+
+type responseStatusKey struct{}
+
+/*
+ResponseStatus returns the status code of the response being encoded for a
+request passed to a [RequestMarshaler], or 0 if there is none.
+*/
+func ResponseStatus(r *http.Request) int {
+	status, _ := r.Context().Value(responseStatusKey{}).(int)
+	return status
+}
+
 /*
 Response object returned by a [Handler] function.
 */
@@ -25,6 +50,9 @@ type Response struct {
 	Cookie []http.Cookie
 	// Response headers to set.
 	Headers map[string]string
+	// Additional response header values, sent after the value of the same
+	// key in Headers, for headers which are sent more than once.
+	HeaderValues http.Header
 	// RedirectURI for 3XX status code responses.
 	RedirectURI string
 	// HTTP status code to send.
@@ -48,6 +76,31 @@ func (r *Response) SetBody(value any) *Response {
 	return r
 }
 
+/*
+Set a raw response body sent as is, without a [ResponseEncoder]. The
+content can be an [io.Reader], [io.WriterTo] or []byte, and is closed once
+sent if it implements [io.Closer]. If the content type is empty it is
+detected with [http.DetectContentType].
+
+See [RawBody].
+*/
+func (r *Response) SetRaw(contentType string, content any) *Response {
+	r.Body = &RawBody{ContentType: contentType, Content: content}
+	return r
+}
+
+/*
+Set a file of a [fs.FS] as raw response body. The file is opened when the
+response is sent, and a 404 status code is sent if it does not exist. The
+content type is detected from the file name extension, or from the content.
+
+See [RawBody].
+*/
+func (r *Response) SetFile(fsys fs.FS, name string) *Response {
+	r.Body = &RawBody{fsys: fsys, name: name}
+	return r
+}
+
 /*
 Set http.Cookie values to be sent in the response headers.
 */
@@ -57,13 +110,33 @@ func (r *Response) SetCookies(value []http.Cookie) *Response {
 }
 
 /*
-Set a header value. Any existing value will be overwritten.
+Set a header value. Any existing value will be overwritten, including
+values set with [Response.AddHeader], and values set with a key of
+different casing, like "content-type" for "Content-Type".
 */
 func (r *Response) SetHeader(key string, value string) *Response {
 	if r.Headers == nil {
 		r.Headers = make(map[string]string)
 	}
+	for k := range r.Headers {
+		if k != key && http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(key) {
+			delete(r.Headers, k)
+		}
+	}
 	r.Headers[key] = value
+	r.HeaderValues.Del(key)
+	return r
+}
+
+/*
+Add a header value, keeping any existing values of the header, like for
+"WWW-Authenticate" challenges or "Link" headers.
+*/
+func (r *Response) AddHeader(key string, value string) *Response {
+	if r.HeaderValues == nil {
+		r.HeaderValues = make(http.Header)
+	}
+	r.HeaderValues.Add(key, value)
 	return r
 }
 
@@ -75,6 +148,7 @@ func (r *Response) SetHeaders(headers map[string]string) *Response {
 		r.Headers = make(map[string]string)
 	}
 	r.Headers = headers
+	r.HeaderValues = nil
 	return r
 }
 
@@ -1,6 +1,7 @@
 package hiccup_test
 
 import (
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -43,3 +44,47 @@ func TestResponse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestResponse_AddHeader(t *testing.T) {
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		res := hiccup.Respond(http.StatusOK).
+			SetHeader("Link", "</a>; rel=first").
+			AddHeader("link", "</b>; rel=next").
+			AddHeader("Link", "</c>; rel=last")
+		if r.URL.Path == "/set" {
+			res.SetHeader("link", "</d>")
+		}
+		return res
+	})
+
+	_, header := handler.Invoke(httptestRequest("GET", "/"))
+	if fmt.Sprint(header.Values("Link")) != "[</a>; rel=first </b>; rel=next </c>; rel=last]" {
+		t.Error("added header values not sent", header.Values("Link"))
+		t.FailNow()
+	}
+
+	_, header = handler.Invoke(httptestRequest("GET", "/set"))
+	if fmt.Sprint(header.Values("Link")) != "[</d>]" {
+		t.Error("added header values not overwritten", header.Values("Link"))
+		t.FailNow()
+	}
+}
+
+func TestResponse_SetHeaderCasing(t *testing.T) {
+	r := hiccup.Respond(http.StatusOK).
+		SetHeader("content-type", "text/plain").
+		SetHeader("CONTENT-TYPE", "text/csv").
+		SetHeader("Content-Type", "application/json")
+	if len(r.Headers) != 1 || r.Headers["Content-Type"] != "application/json" {
+		t.Error("differently cased header keys not replaced", r.Headers)
+		t.FailNow()
+	}
+
+	r.SetHeader("x-custom", "a").SetHeader("X-Custom", "b")
+	_, header := hiccup.Handler(func(*http.Request) *hiccup.Response { return r }).
+		Invoke(httptestRequest("GET", "/"))
+	if header.Get("X-Custom") != "b" || len(header.Values("X-Custom")) != 1 {
+		t.Error("unexpected header values", header)
+		t.FailNow()
+	}
+}
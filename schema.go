@@ -0,0 +1,610 @@
+package hiccup
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSON Schema dialect used for all generated schemas.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+/*
+Schema is a JSON Schema (draft 2020-12) document, or a subschema within
+one. Schemas are generated from Go types with [SchemaOf], and are also
+used to describe request and response bodies in an [OpenAPI] document.
+
+Schemas can be marshaled with any json or yaml [Marshaler].
+*/
+type Schema struct {
+	// Dialect of the root schema.
+	Schema string `json:"$schema,omitempty" yaml:"$schema,omitempty"`
+	// Reference to a schema definition.
+	Ref string `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	// Human readable description of the schema.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// JSON type of the value.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Format of a string value, like "date-time".
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Encoding of string content, like "base64".
+	ContentEncoding string `json:"contentEncoding,omitempty" yaml:"contentEncoding,omitempty"`
+	// Minimum value of a number.
+	Minimum *float64 `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	// Schema of every array item.
+	Items *Schema `json:"items,omitempty" yaml:"items,omitempty"`
+	// Schemas of known object properties.
+	Properties map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	// Names of object properties which must be present.
+	Required []string `json:"required,omitempty" yaml:"required,omitempty"`
+	// Schema of object properties not listed in Properties.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	// Named schema definitions referenced from the root schema.
+	Defs map[string]*Schema `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+}
+
+/*
+SchemaOf returns a JSON Schema for the type of the passed value. Struct
+fields are named and omitted following their "json" tags, like
+encoding/json does. No properties are required, since fields missing from
+a body keep their value when it is unmarshaled. Types with their own
+unmarshaler, like [json.RawMessage], accept any value. Named struct types are
+collected in the "$defs" of the returned schema so recursive types can
+be described.
+*/
+func SchemaOf(v any) *Schema {
+	return schemaOf(v, "json")
+}
+
+/*
+schemaOf returns the schema for the type of the passed value, with struct
+fields named following the passed struct tag.
+*/
+func schemaOf(v any, tag string) *Schema {
+	g := newSchemaGenerator("#/$defs/", tag)
+	s := g.schema(reflect.TypeOf(v))
+	s.Schema = schemaDialect
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s
+}
+
+/*
+SchemaRegistry caches the schemas of Go types, and publishes the schemas of
+named types by their name.
+
+A registry passed to [RequestDecoder.SetSchemas] collects the schema of
+every type request content is decoded to, so the schemas used for request
+validation can be served at runtime with [SchemaRegistry.Serve].
+*/
+type SchemaRegistry struct {
+	mu     sync.RWMutex
+	types  map[schemaKey]*Schema
+	byName map[string]*Schema
+}
+
+/*
+schemaKey identifies a registered schema by its Go type and the struct tag
+its fields are named with.
+*/
+type schemaKey struct {
+	t   reflect.Type
+	tag string
+}
+
+/*
+NewSchemaRegistry returns an empty [SchemaRegistry].
+*/
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		types:  make(map[schemaKey]*Schema),
+		byName: make(map[string]*Schema),
+	}
+}
+
+/*
+Register returns the schema for the type of the passed value, generating
+it with [SchemaOf] if the type was not registered before. Named types are
+published under their type name.
+*/
+func (s *SchemaRegistry) Register(v any) *Schema {
+	return s.register(v, "json")
+}
+
+/*
+register returns the schema for the type of the passed value with struct
+fields named following the passed struct tag. Yaml schemas of named types
+are only published if there is no json schema for the type.
+*/
+func (s *SchemaRegistry) register(v any, tag string) *Schema {
+	key := schemaKey{t: reflect.TypeOf(v), tag: tag}
+	s.mu.RLock()
+	schema, ok := s.types[key]
+	s.mu.RUnlock()
+	if ok {
+		return schema
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if schema, ok := s.types[key]; ok {
+		return schema
+	}
+
+	schema = schemaOf(v, tag)
+	s.types[key] = schema
+	t := key.t
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && t.Name() != "" {
+		if _, ok := s.byName[schemaName(t)]; !ok || tag == "json" {
+			s.byName[schemaName(t)] = schema
+		}
+	}
+	return schema
+}
+
+/*
+Lookup returns the published schema with the passed name, or nil if no
+schema is registered with the name.
+*/
+func (s *SchemaRegistry) Lookup(name string) *Schema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byName[name]
+}
+
+/*
+Names returns the sorted names of all published schemas.
+*/
+func (s *SchemaRegistry) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.byName))
+	for name := range s.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+Serve implements the [HandlerFunc] interface to serve published schemas.
+The schema name is read from the "name" path value of the request, so it
+can be served with a [http.ServeMux] pattern:
+
+	mux.Handle("GET /schemas/{name}", hiccup.Handler(registry.Serve, encoders...))
+
+Requests without a name value receive the list of published names.
+*/
+func (s *SchemaRegistry) Serve(r *http.Request) *Response {
+	name := r.PathValue("name")
+	if name == "" {
+		return Respond(http.StatusOK).SetBody(s.Names())
+	}
+
+	schema := s.Lookup(name)
+	if schema == nil {
+		return Respond(http.StatusNotFound).SetBody(http.StatusText(http.StatusNotFound))
+	}
+	return Respond(http.StatusOK).SetBody(schema)
+}
+
+/*
+schemaGenerator builds schemas for Go types, and collects named struct
+types as schema definitions referenced with the configured prefix. Struct
+fields are named following the configured struct tag.
+
+A generator with a shared generator reuses its definitions for types named
+the same way by both, and adds its own definitions to the shared ones with
+the tag as a name suffix otherwise.
+*/
+type schemaGenerator struct {
+	prefix string
+	tag    string
+	defs   map[string]*Schema
+	names  map[reflect.Type]string
+	shared *schemaGenerator
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func newSchemaGenerator(prefix string, tag string) *schemaGenerator {
+	return &schemaGenerator{
+		prefix: prefix,
+		tag:    tag,
+		defs:   make(map[string]*Schema),
+		names:  make(map[reflect.Type]string),
+	}
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if customUnmarshaler(t, g.tag) {
+		// any value can be valid for the type.
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := float64(0)
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: g.prefix + g.define(t)}
+	default:
+		return &Schema{}
+	}
+}
+
+/*
+define adds a schema definition for the named type t, and returns the
+name it was defined with.
+*/
+func (g *schemaGenerator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	base := schemaName(t)
+	if g.shared != nil {
+		if sameFieldNames(t, g.tag, g.shared.tag, make(map[reflect.Type]bool)) {
+			name := g.shared.define(t)
+			g.names[t] = name
+			return name
+		}
+		base += "_" + g.tag
+	}
+	name := base
+	for i := 2; g.defs[name] != nil; i++ {
+		name = base + strconv.Itoa(i)
+	}
+
+	// register a placeholder first so recursive types resolve to a ref.
+	def := new(Schema)
+	g.names[t] = name
+	g.defs[name] = def
+	*def = *g.object(t)
+	return name
+}
+
+func (g *schemaGenerator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range structFields(t, g.tag) {
+		p := g.schema(f.Type)
+		if f.Quoted {
+			p = &Schema{Type: "string"}
+		}
+		s.Properties[f.Name] = p
+	}
+	return s
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+/*
+customUnmarshaler reports whether values of t are decoded by their own
+unmarshaler for content with the passed struct tag, like a json.RawMessage
+or a type with an UnmarshalJSON method. Yaml unmarshalers are matched by
+their UnmarshalYAML method, to support every yaml package.
+*/
+func customUnmarshaler(t reflect.Type, tag string) bool {
+	pt := reflect.PointerTo(t)
+	if pt.Implements(textUnmarshalerType) {
+		return true
+	}
+	if tag == "yaml" {
+		_, ok := pt.MethodByName("UnmarshalYAML")
+		return ok
+	}
+	return pt.Implements(jsonUnmarshalerType)
+}
+
+/*
+sameFieldNames reports whether the struct fields of t, and of every type
+reachable from it, have the same names with both struct tags.
+*/
+func sameFieldNames(t reflect.Type, a string, b string, seen map[reflect.Type]bool) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+			continue
+		}
+		break
+	}
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return true
+	}
+	seen[t] = true
+
+	fa, fb := structFields(t, a), structFields(t, b)
+	if len(fa) != len(fb) {
+		return false
+	}
+	for i := range fa {
+		if fa[i].Name != fb[i].Name || fa[i].Quoted != fb[i].Quoted || !slices.Equal(fa[i].Index, fb[i].Index) {
+			return false
+		}
+		if !sameFieldNames(fa[i].Type, a, b, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+schemaTag returns the struct tag the fields of content with the passed
+media type are named with, which is "yaml" for yaml media types and "json"
+for any other.
+*/
+func schemaTag(contentType string) string {
+	m := mediaTypeOf(contentType)
+	if m.Subtype == "yaml" || m.Subtype == "x-yaml" || m.Suffix() == "yaml" {
+		return "yaml"
+	}
+	return "json"
+}
+
+/*
+schemaName returns a definition name for a named type. Package paths
+are trimmed from the type parameters of generic types.
+*/
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	i := strings.IndexByte(name, '[')
+	if i < 0 {
+		return name
+	}
+
+	params := strings.Split(strings.TrimSuffix(name[i+1:], "]"), ",")
+	for n, p := range params {
+		if j := strings.LastIndexByte(p, '/'); j >= 0 {
+			p = p[j+1:]
+		}
+		if j := strings.LastIndexByte(p, '.'); j >= 0 {
+			p = p[j+1:]
+		}
+		params[n] = p
+	}
+	return name[:i] + "_" + strings.Join(params, "_")
+}
+
+/*
+structField describes an encoded field of a struct type, following the
+naming rules of the "json" or "yaml" struct tag.
+*/
+type structField struct {
+	// Encoded field name.
+	Name string
+	// Index sequence for [reflect.Value.FieldByIndex].
+	Index []int
+	// Go type of the field.
+	Type reflect.Type
+	// Field tag has the "omitempty" option.
+	OmitEmpty bool
+	// Field tag has the "string" option, and the field is encoded as a
+	// json string.
+	Quoted bool
+	// Field has a tag name.
+	Tagged bool
+	// Underlying struct field.
+	Field reflect.StructField
+}
+
+/*
+structFields returns the encoded fields of a struct type, named with the
+passed struct tag, which is "json" or "yaml".
+
+Json fields follow the rules of encoding/json: unexported fields and fields
+tagged "-" are skipped, and the fields of untagged embedded structs are
+promoted. Fields sharing a name are resolved to the shallowest one, or the
+tagged one if several are at the same depth, and are dropped if that is
+still ambiguous.
+
+Yaml fields are named by their tag or their lower case Go name, and only
+the fields of embedded structs with the "inline" option are promoted.
+*/
+func structFields(t reflect.Type, tag string) []structField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if tag == "yaml" {
+		return yamlFields(t, nil)
+	}
+	return jsonFields(t)
+}
+
+func jsonFields(t reflect.Type) []structField {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+
+	var fields []structField
+	next := []embedded{{t: t}}
+	visited := make(map[reflect.Type]bool)
+	for len(next) > 0 {
+		current := next
+		next = nil
+		// structs embedded at the same depth more than once annihilate each
+		// other's fields, so they are walked once per occurrence.
+		explored := make(map[reflect.Type]bool)
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			explored[e.t] = true
+
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				idx := append(append([]int{}, e.index...), i)
+
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{t: ft, index: idx})
+					continue
+				}
+				f := structField{
+					Name:      name,
+					Index:     idx,
+					Type:      sf.Type,
+					OmitEmpty: hasTagOption(opts, "omitempty") || hasTagOption(opts, "omitzero"),
+					Tagged:    name != "",
+					Field:     sf,
+				}
+				if f.Name == "" {
+					f.Name = sf.Name
+				}
+				if hasTagOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64, reflect.String:
+						f.Quoted = true
+					}
+				}
+				fields = append(fields, f)
+			}
+		}
+		for t := range explored {
+			visited[t] = true
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].Name != fields[j].Name {
+			return fields[i].Name < fields[j].Name
+		}
+		if len(fields[i].Index) != len(fields[j].Index) {
+			return len(fields[i].Index) < len(fields[j].Index)
+		}
+		return fields[i].Tagged && !fields[j].Tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].Name == fields[i].Name {
+			j++
+		}
+		// the first field is dominant, unless the next one is as deep and
+		// as tagged.
+		if j-i == 1 || len(fields[i].Index) != len(fields[i+1].Index) || fields[i].Tagged != fields[i+1].Tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return slices.Compare(out[i].Index, out[j].Index) < 0
+	})
+	return out
+}
+
+func yamlFields(t reflect.Type, index []int) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		idx := append(append([]int{}, index...), i)
+
+		if hasTagOption(opts, "inline") {
+			ft := sf.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, yamlFields(ft, idx)...)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		f := structField{
+			Name:      name,
+			Index:     idx,
+			Type:      sf.Type,
+			OmitEmpty: hasTagOption(opts, "omitempty"),
+			Tagged:    name != "",
+			Field:     sf,
+		}
+		if f.Name == "" {
+			f.Name = strings.ToLower(sf.Name)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func hasTagOption(opts string, option string) bool {
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(opts, ",")
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
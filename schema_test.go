@@ -0,0 +1,212 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/afloesch/hiccup"
+)
+
+type testAuthor struct {
+	Name string `json:"name"`
+}
+
+type testArticle struct {
+	ID        int               `json:"id"`
+	Title     string            `json:"title"`
+	Tags      []string          `json:"tags,omitempty"`
+	Author    *testAuthor       `json:"author,omitempty"`
+	Related   []*testArticle    `json:"related,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Published time.Time         `json:"published"`
+	Data      []byte            `json:"data,omitempty"`
+	Views     uint              `json:"views,omitempty"`
+	Secret    string            `json:"-"`
+	internal  string
+}
+
+func ExampleSchemaOf() {
+	type Message struct {
+		Text string `json:"text"`
+	}
+
+	b, _ := json.Marshal(hiccup.SchemaOf(Message{}))
+	fmt.Println(string(b))
+	// Output: {"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/Message","$defs":{"Message":{"type":"object","properties":{"text":{"type":"string"}}}}}
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := hiccup.SchemaOf(&testArticle{})
+	if s.Ref != "#/$defs/testArticle" {
+		t.Error("unexpected root ref", s.Ref)
+		t.FailNow()
+	}
+
+	def := s.Defs["testArticle"]
+	if def == nil || def.Type != "object" {
+		t.Error("missing article definition")
+		t.FailNow()
+	}
+	if len(def.Required) != 0 {
+		t.Error("unexpected required fields", def.Required)
+		t.FailNow()
+	}
+	if _, ok := def.Properties["Secret"]; ok {
+		t.Error("ignored field in schema")
+		t.FailNow()
+	}
+	if _, ok := def.Properties["internal"]; ok {
+		t.Error("unexported field in schema")
+		t.FailNow()
+	}
+	if def.Properties["related"].Items.Ref != "#/$defs/testArticle" {
+		t.Error("recursive type not referenced", def.Properties["related"].Items)
+		t.FailNow()
+	}
+	if def.Properties["author"].Ref != "#/$defs/testAuthor" {
+		t.Error("pointer type not referenced")
+		t.FailNow()
+	}
+	if def.Properties["published"].Format != "date-time" {
+		t.Error("time not described as date-time")
+		t.FailNow()
+	}
+	if def.Properties["data"].ContentEncoding != "base64" {
+		t.Error("bytes not described as base64")
+		t.FailNow()
+	}
+	if def.Properties["meta"].AdditionalProperties.Type != "string" {
+		t.Error("map values not described")
+		t.FailNow()
+	}
+	if *def.Properties["views"].Minimum != 0 {
+		t.Error("unsigned minimum not set")
+		t.FailNow()
+	}
+
+	type embedded struct {
+		testAuthor
+		Score float64 `json:"score,string"`
+		Any   any
+	}
+	s = hiccup.SchemaOf(embedded{})
+	def = s.Defs["embedded"]
+	if def.Properties["name"] == nil {
+		t.Error("embedded field not promoted")
+		t.FailNow()
+	}
+	if def.Properties["score"].Type != "string" {
+		t.Error("quoted field not described as string")
+		t.FailNow()
+	}
+	if def.Properties["Any"].Type != "" {
+		t.Error("interface field should accept any value")
+		t.FailNow()
+	}
+
+	s = hiccup.SchemaOf([]int{})
+	if s.Type != "array" || s.Items.Type != "integer" || s.Defs != nil {
+		t.Error("unexpected slice schema", s)
+		t.FailNow()
+	}
+}
+
+func ExampleSchemaRegistry_Serve() {
+	type Message struct {
+		Text string `json:"text"`
+	}
+
+	// validate request content, and collect the schemas used.
+	schemas := hiccup.NewSchemaRegistry()
+	hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal)).SetSchemas(schemas)
+	schemas.Register(Message{})
+
+	// publish the schemas.
+	mux := http.NewServeMux()
+	mux.Handle("GET /schemas/{name}", hiccup.Handler(schemas.Serve, hiccup.WithEncoder("application/json", json.Marshal)))
+
+	w, req := testRequest("GET", "/schemas/Message", nil)
+	mux.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Println(string(body))
+	// Output: {"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/Message","$defs":{"Message":{"type":"object","properties":{"text":{"type":"string"}}}}}
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	reg := hiccup.NewSchemaRegistry()
+	s := reg.Register(&testArticle{})
+	if reg.Register(&testArticle{}) != s {
+		t.Error("schema not cached")
+		t.FailNow()
+	}
+	reg.Register(map[string]string{})
+
+	names := reg.Names()
+	if len(names) != 1 || names[0] != "testArticle" {
+		t.Error("unexpected schema names", names)
+		t.FailNow()
+	}
+	if reg.Lookup("testArticle") != s || reg.Lookup("missing") != nil {
+		t.Error("unexpected lookup result")
+		t.FailNow()
+	}
+
+	req, _ := http.NewRequest("GET", "/schemas/missing", nil)
+	req.SetPathValue("name", "missing")
+	if res := reg.Serve(req); res.StatusCode != http.StatusNotFound {
+		t.Error("expected a not found response")
+		t.FailNow()
+	}
+
+	req, _ = http.NewRequest("GET", "/schemas", nil)
+	res := reg.Serve(req)
+	if list, ok := res.Body.([]string); !ok || len(list) != 1 {
+		t.Error("expected the schema names", res.Body)
+		t.FailNow()
+	}
+}
+
+func TestSchemaOf_EmbeddedFields(t *testing.T) {
+	type base struct {
+		ID    int
+		Name  string
+		Label string `json:"label"`
+	}
+	type other struct {
+		Name  string
+		Label string
+		Kind  string
+	}
+	type item struct {
+		base
+		other
+		ID int `json:"id"`
+	}
+
+	s := hiccup.SchemaOf(item{})
+	def := s.Defs["item"]
+	if def == nil {
+		t.Error("missing item definition")
+		t.FailNow()
+	}
+	// the shallower field wins, tagged fields win at the same depth, and
+	// ambiguous fields are dropped, like with encoding/json.
+	b, _ := json.Marshal(item{})
+	var want map[string]any
+	json.Unmarshal(b, &want)
+	if len(def.Properties) != len(want) || def.Properties["Name"] != nil {
+		t.Error("unexpected properties", def.Properties, want)
+		t.FailNow()
+	}
+	for name := range want {
+		if def.Properties[name] == nil {
+			t.Error("missing property", name, def.Properties)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package hiccup
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+/*
+Tracer starts spans. It mirrors the shape of an OpenTelemetry tracer, so an
+adapter for one only takes a few lines of code.
+*/
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+/*
+Span is a single traced operation started by a [Tracer].
+*/
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+/*
+Meter records metric measurements, like an OpenTelemetry histogram.
+*/
+type Meter interface {
+	Record(ctx context.Context, name string, value float64, attrs ...Attribute)
+}
+
+/*
+Attribute is a key value pair describing a span or measurement.
+*/
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+/*
+Telemetry returns an [Observer] which emits spans through the passed
+[Tracer], and measurements through the passed [Meter]. Either may be nil.
+
+The spans emitted are "hiccup.handler", "hiccup.decode", and "hiccup.encode".
+Durations are recorded in seconds as "hiccup.handler.duration",
+"hiccup.decode.duration", and "hiccup.encode.duration", and body sizes in
+bytes as "hiccup.decode.size" and "hiccup.encode.size".
+*/
+func Telemetry(t Tracer, m Meter) Observer {
+	return &telemetry{tracer: t, meter: m}
+}
+
+type telemetry struct {
+	tracer Tracer
+	meter  Meter
+}
+
+type telemetryKey string
+
+type telemetryPhase struct {
+	span  Span
+	start time.Time
+}
+
+func (t *telemetry) start(ctx context.Context, name string, attrs ...Attribute) context.Context {
+	p := &telemetryPhase{start: time.Now()}
+	if t.tracer != nil {
+		ctx, p.span = t.tracer.Start(ctx, "hiccup."+name)
+		p.span.SetAttributes(attrs...)
+	}
+	return context.WithValue(ctx, telemetryKey(name), p)
+}
+
+func (t *telemetry) end(ctx context.Context, name string, size int, err error, attrs ...Attribute) {
+	p, ok := ctx.Value(telemetryKey(name)).(*telemetryPhase)
+	if !ok {
+		return
+	}
+
+	if p.span != nil {
+		p.span.SetAttributes(attrs...)
+		if err != nil {
+			p.span.RecordError(err)
+		}
+		p.span.End()
+	}
+	if t.meter != nil {
+		t.meter.Record(ctx, "hiccup."+name+".duration", time.Since(p.start).Seconds(), attrs...)
+		if size >= 0 {
+			t.meter.Record(ctx, "hiccup."+name+".size", float64(size), attrs...)
+		}
+	}
+}
+
+func (t *telemetry) DecodeStart(ctx context.Context, r *http.Request) context.Context {
+	return t.start(ctx, "decode")
+}
+
+func (t *telemetry) DecodeEnd(ctx context.Context, e DecodeEvent) {
+	t.end(ctx, "decode", e.Bytes, e.Err,
+		Attribute{Key: "content_type", Value: e.ContentType},
+		Attribute{Key: "size", Value: e.Bytes},
+	)
+}
+
+func (t *telemetry) HandlerStart(ctx context.Context, r *http.Request) context.Context {
+	return t.start(ctx, "handler",
+		Attribute{Key: "http.method", Value: r.Method},
+		Attribute{Key: "url.path", Value: r.URL.Path},
+	)
+}
+
+func (t *telemetry) HandlerEnd(ctx context.Context, res *Response) {
+	t.end(ctx, "handler", -1, nil,
+		Attribute{Key: "http.status_code", Value: res.StatusCode},
+	)
+}
+
+func (t *telemetry) Negotiated(ctx context.Context, e NegotiationEvent) {
+	if p, ok := ctx.Value(telemetryKey("handler")).(*telemetryPhase); ok && p.span != nil {
+		p.span.SetAttributes(
+			Attribute{Key: "http.accept", Value: e.Accept},
+			Attribute{Key: "content_type", Value: e.ContentType},
+			Attribute{Key: "negotiation.default", Value: e.Default},
+		)
+	}
+}
+
+func (t *telemetry) EncodeStart(ctx context.Context) context.Context {
+	return t.start(ctx, "encode")
+}
+
+func (t *telemetry) EncodeEnd(ctx context.Context, e EncodeEvent) {
+	t.end(ctx, "encode", e.Bytes, e.Err,
+		Attribute{Key: "content_type", Value: e.ContentType},
+		Attribute{Key: "size", Value: e.Bytes},
+	)
+}
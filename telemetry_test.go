@@ -0,0 +1,152 @@
+package hiccup_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+)
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, hiccup.Span) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	s := &testSpan{name: name, parent: parent, attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+func (s *testSpan) SetAttributes(attrs ...hiccup.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+type testMeter struct {
+	values map[string]float64
+}
+
+func (m *testMeter) Record(ctx context.Context, name string, value float64, attrs ...hiccup.Attribute) {
+	m.values[name] = value
+}
+
+func ExampleTelemetry() {
+	tracer := new(testTracer) // adapt an OpenTelemetry tracer here
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		return hiccup.Respond(http.StatusOK).SetBody("Hello World!")
+	}).SetObserver(hiccup.Telemetry(tracer, nil))
+
+	w, req := testRequest("GET", "/", nil)
+	handler.ServeHTTP(w, req)
+
+	for _, s := range tracer.spans {
+		fmt.Println(s.name, s.ended)
+	}
+	// Output:
+	// hiccup.handler true
+	// hiccup.encode true
+}
+
+func TestTelemetry(t *testing.T) {
+	tracer := new(testTracer)
+	meter := &testMeter{values: make(map[string]float64)}
+	dec := hiccup.Decoder(hiccup.WithDecoder("application/json", json.Unmarshal))
+	handler := hiccup.Handler(func(r *http.Request) *hiccup.Response {
+		var m map[string]string
+		if _, err := dec.DecodeBody(r, &m); err != nil {
+			return hiccup.Respond(http.StatusBadRequest).SetBody(err.Error())
+		}
+		return hiccup.Respond(http.StatusOK).SetBody(m)
+	}, hiccup.WithEncoder("application/json", json.Marshal)).
+		SetObserver(hiccup.Telemetry(tracer, meter))
+
+	w, req := testRequest("POST", "/articles", bytes.NewBufferString(`{"a":"b"}`))
+	handler.ServeHTTP(w, req)
+
+	if len(tracer.spans) != 3 {
+		t.Error("unexpected spans", tracer.spans)
+		t.FailNow()
+	}
+	handlerSpan, decodeSpan, encodeSpan := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if handlerSpan.name != "hiccup.handler" || decodeSpan.name != "hiccup.decode" || encodeSpan.name != "hiccup.encode" {
+		t.Error("unexpected span names")
+		t.FailNow()
+	}
+	if decodeSpan.parent != handlerSpan || encodeSpan.parent != handlerSpan {
+		t.Error("phase spans not nested in the handler span")
+		t.FailNow()
+	}
+	if !handlerSpan.ended || !decodeSpan.ended || !encodeSpan.ended {
+		t.Error("spans not ended")
+		t.FailNow()
+	}
+	if handlerSpan.attrs["http.status_code"] != http.StatusOK ||
+		handlerSpan.attrs["url.path"] != "/articles" ||
+		handlerSpan.attrs["content_type"] != "application/json" ||
+		handlerSpan.attrs["negotiation.default"] != true {
+		t.Error("unexpected handler attributes", handlerSpan.attrs)
+		t.FailNow()
+	}
+	if decodeSpan.attrs["size"] != 9 || encodeSpan.attrs["size"] != 9 {
+		t.Error("unexpected size attributes")
+		t.FailNow()
+	}
+
+	var names []string
+	for name := range meter.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := "[hiccup.decode.duration hiccup.decode.size hiccup.encode.duration hiccup.encode.size hiccup.handler.duration]"
+	if fmt.Sprint(names) != want {
+		t.Error("unexpected metrics", names)
+		t.FailNow()
+	}
+	if meter.values["hiccup.encode.size"] != 9 {
+		t.Error("unexpected encode size", meter.values)
+		t.FailNow()
+	}
+
+	// errors are recorded on the span, and a nil tracer only records metrics.
+	tracer.spans = nil
+	w, req = testRequest("POST", "/", bytes.NewBufferString(`{`))
+	handler.ServeHTTP(w, req)
+	if tracer.spans[1].err == nil {
+		t.Error("decode error not recorded")
+		t.FailNow()
+	}
+
+	meter.values = make(map[string]float64)
+	handler.SetObserver(hiccup.Telemetry(nil, meter))
+	w, req = testRequest("POST", "/", bytes.NewBufferString(`{"a":"b"}`))
+	handler.ServeHTTP(w, req)
+	if len(meter.values) != 5 {
+		t.Error("unexpected metrics", meter.values)
+		t.FailNow()
+	}
+
+	// end callbacks without a started phase are ignored.
+	o := hiccup.Telemetry(tracer, meter)
+	o.EncodeEnd(context.Background(), hiccup.EncodeEvent{})
+	o.Negotiated(context.Background(), hiccup.NegotiationEvent{})
+}
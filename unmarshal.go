@@ -1,8 +1,8 @@
 package hiccup
 
 import (
+	"fmt"
 	"io"
-	"mime"
 	"net/http"
 )
 
@@ -29,8 +29,15 @@ content types.
 See the [Decoder] function for more info.
 */
 type RequestDecoder struct {
-	decoder        map[string]BodyDecoder
+	decoders       []BodyDecoder
+	types          []MediaType
 	defaultDecoder BodyDecoder
+	schemas        *SchemaRegistry
+	envelope       string
+	observer       Observer
+
+	redaction         *Redaction
+	redactionEncoders []ResponseEncoder
 }
 
 /*
@@ -70,17 +77,33 @@ no "Content-Type" header is sent, or if the value cannot be matched with a
 */
 func Decoder(d ...BodyDecoder) *RequestDecoder {
 	dec := new(RequestDecoder)
+	dec.decoders = d
 	if len(d) > 0 {
 		dec.defaultDecoder = d[0]
 	}
 
-	dec.decoder = make(map[string]BodyDecoder)
 	for _, v := range d {
-		dec.decoder[v.ContentType()] = v
+		dec.types = append(dec.types, mediaTypeOf(v.ContentType()))
 	}
 	return dec
 }
 
+/*
+SetSchemas enables validation of request body content. The schema of the
+value passed to DecodeBody is registered in the passed [SchemaRegistry],
+and the body content is validated against it before unmarshaling. Json and
+yaml content validate the same way, since both decode to the same generic
+values, against schemas with fields named following the "json" or "yaml"
+struct tags respectively. Null values are accepted for every field, like
+unmarshaling does.
+
+Passing a nil registry disables validation.
+*/
+func (r *RequestDecoder) SetSchemas(s *SchemaRegistry) *RequestDecoder {
+	r.schemas = s
+	return r
+}
+
 /*
 DecodeBody with the matched BodyDecoder for the specified "Content-Type" header value
 sent in the [http.Request]. If no match is found the default decoder will be used.
@@ -90,32 +113,114 @@ request body will be unmarshaled to.
 
 It returns the raw bytes of the request body, as well as any error if one was
 encountered during unmarshaling.
+If the "Content-Type" header declares a charset other than UTF-8 the body is
+transcoded to UTF-8 before it is unmarshaled, and the transcoded bytes are
+returned. Charsets missing from the charset table return [ErrUnknownCharset].
 If no decoders are configured the passed value will not be modified, and only
 the raw bytes of the request body will be returned.
 If the request is nil, or if the body is empty, it returns a nil byte array and
 a nil error.
+If schema validation is enabled with [RequestDecoder.SetSchemas], and the body
+content does not conform to the schema, a [ValidationError] is returned and
+the passed value is not modified.
+If redaction is enabled with [RequestDecoder.SetRedaction], the returned bytes
+are redacted, and bodies which cannot be redacted return a nil byte array and
+an error wrapping [ErrRedaction].
 */
 func (r *RequestDecoder) DecodeBody(req *http.Request, v any) ([]byte, error) {
 	if req == nil {
 		return nil, nil
 	}
 
+	o := r.observer
+	if o == nil {
+		o = observerFrom(req.Context())
+	}
+
+	ctx := req.Context()
+	if o != nil {
+		ctx = o.DecodeStart(ctx, req)
+	}
+	contype, b, err := r.decodeBody(req, v)
+	if o != nil {
+		o.DecodeEnd(ctx, DecodeEvent{
+			ContentType: contype,
+			Bytes:       len(b),
+			Err:         err,
+		})
+	}
+	if r.redaction != nil && b != nil {
+		var rerr error
+		if b, rerr = r.redactRaw(contype, b, v); err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		logError(req.Context(), fmt.Errorf("decoding request body: %w", err))
+	}
+	return b, err
+}
+
+/*
+decodeBody reads and decodes the request body, and returns the content type
+of the decoder used along with the raw body bytes.
+*/
+func (r *RequestDecoder) decodeBody(req *http.Request, v any) (string, []byte, error) {
 	b, err := io.ReadAll(req.Body)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 	defer req.Body.Close()
 
 	if len(b) == 0 {
-		return nil, nil
+		return "", nil, nil
+	}
+
+	decFunc := r.defaultDecoder
+	if contype := req.Header.Get("Content-Type"); contype != "" {
+		m, err := ParseMediaType(contype)
+		if err != nil {
+			logError(req.Context(), fmt.Errorf("parsing content type header: %w", err))
+		} else if i := matchMediaType(r.types, m); i >= 0 {
+			decFunc = r.decoders[i]
+		}
+		if name := m.Params["charset"]; name != "" {
+			c := LookupCharset(name)
+			if c == nil {
+				return "", b, fmt.Errorf("%w: %q", ErrUnknownCharset, name)
+			}
+			if b, err = c.Decode(b); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	if decFunc == nil {
+		return "", b, nil
+	}
+
+	if r.schemas != nil {
+		if err := r.validate(decFunc, b, v); err != nil {
+			return decFunc.ContentType(), b, err
+		}
 	}
+	return decFunc.ContentType(), b, r.unmarshal(decFunc, b, v)
+}
 
-	contype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
-	if decFunc := r.decoder[contype]; decFunc != nil {
-		return b, decFunc.Unmarshal(b, v)
-	} else if decFunc := r.defaultDecoder; decFunc != nil {
-		return b, decFunc.Unmarshal(b, v)
-	} else {
-		return b, nil
+func (r *RequestDecoder) validate(dec BodyDecoder, b []byte, v any) error {
+	var raw any
+	if err := dec.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if r.envelope != "" {
+		m, _ := raw.(map[string]any)
+		data, ok := m[r.envelope]
+		if !ok {
+			return &ValidationError{Errors: []SchemaError{{
+				Pointer: "/" + pointerEscape(r.envelope),
+				Message: "is required",
+			}}}
+		}
+		raw = data
 	}
+	return r.schemas.register(v, schemaTag(dec.ContentType())).validateBody(raw)
 }
@@ -121,3 +121,145 @@ func TestRequestDecoder(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRequestDecoder_SetSchemas(t *testing.T) {
+	type message struct {
+		Text  string `json:"text" yaml:"text"`
+		Count int    `json:"count,omitempty" yaml:"count,omitempty"`
+	}
+
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+	).SetSchemas(hiccup.NewSchemaRegistry())
+
+	_, req := testRequest("POST", "/", bytes.NewBufferString(`{"text": "Hello", "count": 2}`))
+	var m message
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Text != "Hello" {
+		t.Error("unexpected decode result", err, m)
+		t.FailNow()
+	}
+
+	_, req = testRequest("POST", "/", bytes.NewBufferString("count: many\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	m = message{}
+	_, err := dec.DecodeBody(req, &m)
+	var verr *hiccup.ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 {
+		t.Error("expected validation errors", err)
+		t.FailNow()
+	}
+	if verr.Errors[0].Pointer != "/count" {
+		t.Error("unexpected error pointers", verr)
+		t.FailNow()
+	}
+
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{`))
+	if _, err := dec.DecodeBody(req, &m); err == nil || errors.As(err, &verr) {
+		t.Error("expected a syntax error", err)
+		t.FailNow()
+	}
+}
+
+// level decodes from names or numbers.
+type level int
+
+func (l *level) UnmarshalJSON(b []byte) error {
+	if string(b) == `"high"` {
+		*l = 2
+		return nil
+	}
+	return json.Unmarshal(b, (*int)(l))
+}
+
+func (l *level) UnmarshalYAML(n *yaml.Node) error {
+	if n.Value == "high" {
+		*l = 2
+		return nil
+	}
+	return n.Decode((*int)(l))
+}
+
+func TestRequestDecoder_SetSchemasUnmarshal(t *testing.T) {
+	type settings struct {
+		Name  *string         `json:"name" yaml:"name"`
+		Raw   json.RawMessage `json:"raw" yaml:"raw"`
+		Level level           `json:"level" yaml:"level"`
+		Tags  []string        `json:"tags" yaml:"tags"`
+	}
+
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+	).SetSchemas(hiccup.NewSchemaRegistry())
+
+	// bodies json.Unmarshal accepts are valid.
+	for _, body := range []string{
+		`{"name": null, "tags": null}`,
+		`{"name": "a", "tags": ["b", null]}`,
+		`{"raw": {"a": 1}}`,
+		`{"level": "high"}`,
+		`{"level": 1}`,
+		`null`,
+	} {
+		var s settings
+		_, req := testRequest("POST", "/", bytes.NewBufferString(body))
+		if _, err := dec.DecodeBody(req, &s); err != nil {
+			t.Error("unexpected error for", body, err)
+			t.FailNow()
+		}
+	}
+
+	var s settings
+	_, req := testRequest("POST", "/", bytes.NewBufferString("level: high\nname: ~\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	if _, err := dec.DecodeBody(req, &s); err != nil || s.Level != 2 {
+		t.Error("unexpected yaml decode result", err, s)
+		t.FailNow()
+	}
+
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"name": 1}`))
+	var verr *hiccup.ValidationError
+	if _, err := dec.DecodeBody(req, &s); !errors.As(err, &verr) || verr.Errors[0].Pointer != "/name" {
+		t.Error("expected a validation error", err)
+		t.FailNow()
+	}
+}
+
+func TestRequestDecoder_SetSchemasYaml(t *testing.T) {
+	type message struct {
+		Message string
+		Count   int
+	}
+
+	dec := hiccup.Decoder(
+		hiccup.WithDecoder("application/json", json.Unmarshal),
+		hiccup.WithDecoder("application/yaml", yaml.Unmarshal),
+	).SetSchemas(hiccup.NewSchemaRegistry())
+
+	// yaml content is validated with yaml field names.
+	_, req := testRequest("POST", "/", bytes.NewBufferString("message: hi\ncount: 2\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	var m message
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Message != "hi" || m.Count != 2 {
+		t.Error("unexpected decode result", err, m)
+		t.FailNow()
+	}
+
+	_, req = testRequest("POST", "/", bytes.NewBufferString("count: many\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	_, err := dec.DecodeBody(req, &m)
+	var verr *hiccup.ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Pointer != "/count" {
+		t.Error("expected a yaml validation error", err)
+		t.FailNow()
+	}
+
+	// json content is validated with json field names.
+	_, req = testRequest("POST", "/", bytes.NewBufferString(`{"Message": "hey"}`))
+	m = message{}
+	if _, err := dec.DecodeBody(req, &m); err != nil || m.Message != "hey" {
+		t.Error("unexpected decode result", err, m)
+		t.FailNow()
+	}
+}
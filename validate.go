@@ -0,0 +1,234 @@
+package hiccup
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ValidationError is returned when a value does not conform to a [Schema].
+It holds every violation found.
+*/
+type ValidationError struct {
+	Errors []SchemaError
+}
+
+/*
+SchemaError describes a single schema violation.
+*/
+type SchemaError struct {
+	// JSON Pointer to the invalid value, where "" is the root value.
+	Pointer string `json:"pointer" yaml:"pointer"`
+	// Description of the violation.
+	Message string `json:"message" yaml:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	msg := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msg[i] = err.Error()
+	}
+	return strings.Join(msg, "; ")
+}
+
+func (e SchemaError) Error() string {
+	if e.Pointer == "" {
+		return "(root): " + e.Message
+	}
+	return e.Pointer + ": " + e.Message
+}
+
+/*
+Validate checks a decoded value against the schema. The value must be
+made of the generic types an [Unmarshaler] produces when decoding into
+an any value, like map[string]any, []any, string, bool, and numbers, so
+json and yaml content validate the same way.
+
+It returns a [ValidationError] listing every violation, or nil if the
+value is valid.
+*/
+func (s *Schema) Validate(v any) error {
+	vr := &validator{root: s}
+	vr.validate(s, v, "")
+	if len(vr.errs) > 0 {
+		return &ValidationError{Errors: vr.errs}
+	}
+	return nil
+}
+
+/*
+validateBody checks a decoded request body against the schema like
+Validate, but accepts null for every value, since unmarshaling null leaves
+a value unchanged, or sets it to nil.
+*/
+func (s *Schema) validateBody(v any) error {
+	vr := &validator{root: s, nulls: true}
+	vr.validate(s, v, "")
+	if len(vr.errs) > 0 {
+		return &ValidationError{Errors: vr.errs}
+	}
+	return nil
+}
+
+type validator struct {
+	root *Schema
+	errs []SchemaError
+	// Null is accepted for every value.
+	nulls bool
+}
+
+func (vr *validator) fail(ptr string, format string, args ...any) {
+	vr.errs = append(vr.errs, SchemaError{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+func (vr *validator) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		name := s.Ref[strings.LastIndexByte(s.Ref, '/')+1:]
+		def := vr.root.Defs[name]
+		if def == nil {
+			return nil
+		}
+		s = def
+	}
+	return s
+}
+
+func (vr *validator) validate(s *Schema, v any, ptr string) {
+	s = vr.resolve(s)
+	if s == nil || v == nil && vr.nulls {
+		return
+	}
+
+	switch s.Type {
+	case "":
+		return
+	case "object":
+		obj, ok := toObject(v)
+		if !ok {
+			vr.fail(ptr, "expected object, got %s", jsonType(v))
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				vr.fail(ptr+"/"+pointerEscape(name), "is required")
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				vr.validate(p, obj[k], ptr+"/"+pointerEscape(k))
+			} else if s.AdditionalProperties != nil {
+				vr.validate(s.AdditionalProperties, obj[k], ptr+"/"+pointerEscape(k))
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			vr.fail(ptr, "expected array, got %s", jsonType(v))
+			return
+		}
+		for i, item := range arr {
+			vr.validate(s.Items, item, fmt.Sprintf("%s/%d", ptr, i))
+		}
+	case "string":
+		switch str := v.(type) {
+		case string:
+			if s.Format == "date-time" {
+				if _, err := time.Parse(time.RFC3339, str); err != nil {
+					vr.fail(ptr, "expected date-time string")
+				}
+			}
+		case time.Time:
+		default:
+			vr.fail(ptr, "expected string, got %s", jsonType(v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			vr.fail(ptr, "expected boolean, got %s", jsonType(v))
+		}
+	case "integer", "number":
+		n, ok := toNumber(v)
+		if !ok {
+			vr.fail(ptr, "expected %s, got %s", s.Type, jsonType(v))
+			return
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			vr.fail(ptr, "expected integer, got number")
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			vr.fail(ptr, "must be greater than or equal to %v", *s.Minimum)
+		}
+	case "null":
+		if v != nil {
+			vr.fail(ptr, "expected null, got %s", jsonType(v))
+		}
+	}
+}
+
+/*
+toObject converts a decoded mapping to a map with string keys. Some yaml
+decoders produce maps with any key type.
+*/
+func toObject(v any) (map[string]any, bool) {
+	switch m := v.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		obj := make(map[string]any, len(m))
+		for k, val := range m {
+			obj[fmt.Sprint(k)] = val
+		}
+		return obj, true
+	}
+	return nil, false
+}
+
+func toNumber(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func jsonType(v any) string {
+	if v == nil {
+		return "null"
+	}
+	if _, ok := toObject(v); ok {
+		return "object"
+	}
+	if _, ok := toNumber(v); ok {
+		return "number"
+	}
+	switch v.(type) {
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+/*
+pointerEscape escapes a reference token for use in a JSON Pointer.
+*/
+func pointerEscape(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,102 @@
+package hiccup_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/afloesch/hiccup"
+	"go.yaml.in/yaml/v3"
+)
+
+func ExampleSchema_Validate() {
+	type Message struct {
+		Text string `json:"text"`
+	}
+
+	var v any
+	json.Unmarshal([]byte(`{"text": 42}`), &v)
+
+	err := hiccup.SchemaOf(Message{}).Validate(v)
+	fmt.Println(err)
+	// Output: /text: expected string, got number
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema := hiccup.SchemaOf(testArticle{})
+
+	var v any
+	json.Unmarshal([]byte(`{
+		"id": 1,
+		"title": "Hello",
+		"published": "2024-01-02T15:04:05Z",
+		"related": [{"id": 2, "title": "World", "published": "2024-01-02T15:04:05Z"}],
+		"meta": {"a/b": "c"}
+	}`), &v)
+	if err := schema.Validate(v); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	json.Unmarshal([]byte(`{
+		"id": 1.5,
+		"published": "yesterday",
+		"tags": "one",
+		"related": [{"id": -1, "title": true, "published": "2024-01-02T15:04:05Z"}],
+		"meta": {"a/b": 1},
+		"views": -1,
+		"author": []
+	}`), &v)
+	err := schema.Validate(v)
+	var verr *hiccup.ValidationError
+	if !errors.As(err, &verr) {
+		t.Error("expected a validation error", err)
+		t.FailNow()
+	}
+
+	want := map[string]bool{
+		"/id":              true,
+		"/published":       true,
+		"/tags":            true,
+		"/related/0/title": true,
+		"/meta/a~1b":       true,
+		"/views":           true,
+		"/author":          true,
+	}
+	for _, e := range verr.Errors {
+		if !want[e.Pointer] {
+			t.Error("unexpected error", e)
+			t.FailNow()
+		}
+		delete(want, e.Pointer)
+	}
+	if len(want) > 0 {
+		t.Error("missing errors", want, verr)
+		t.FailNow()
+	}
+
+	// yaml content decodes to the same generic values.
+	yaml.Unmarshal([]byte("id: 1\ntitle: Hello\npublished: 2024-01-02T15:04:05Z\nviews: 3\n"), &v)
+	if err := schema.Validate(v); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err := schema.Validate("text"); err == nil || err.Error() != "(root): expected object, got string" {
+		t.Error("unexpected root error", err)
+		t.FailNow()
+	}
+	if err := hiccup.SchemaOf(true).Validate(nil); err == nil {
+		t.Error("expected boolean error")
+		t.FailNow()
+	}
+	if err := hiccup.SchemaOf([]int{}).Validate(map[any]any{1: 2}); err == nil {
+		t.Error("expected array error")
+		t.FailNow()
+	}
+	if err := hiccup.SchemaOf(map[string]any{}).Validate(map[any]any{1: 2}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}